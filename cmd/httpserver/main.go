@@ -1,27 +1,78 @@
 package main
 
 import (
-	"crypto/sha256"
+	"cmp"
 	"errors"
-	"fmt"
-	"io"
 	"log"
-	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
-	"github.com/Supasiti/prac-go-http-protocol/internal/headers"
+	"github.com/Supasiti/prac-go-http-protocol/internal/cache"
+	"github.com/Supasiti/prac-go-http-protocol/internal/compression"
+	"github.com/Supasiti/prac-go-http-protocol/internal/fileserver"
+	"github.com/Supasiti/prac-go-http-protocol/internal/negotiation"
+	"github.com/Supasiti/prac-go-http-protocol/internal/proxy"
 	"github.com/Supasiti/prac-go-http-protocol/internal/request"
 	"github.com/Supasiti/prac-go-http-protocol/internal/response"
 	"github.com/Supasiti/prac-go-http-protocol/internal/server"
+	"github.com/Supasiti/prac-go-http-protocol/internal/sse"
+	"github.com/Supasiti/prac-go-http-protocol/internal/websocket"
 )
 
 const port = 42069
 
+// assets serves the files below ./assets under /assets/
+var assets server.Handler
+
+// httpbin forwards /httpbin/x to https://httpbin.org/x, keeping cacheable responses
+var httpbin server.Handler
+
+// backends spreads /backends/x over the servers listed in BACKENDS (comma separated). It
+// is nil when none are.
+var backends server.Handler
+
+// forward serves clients that use this server as their HTTP proxy. It is off unless
+// PROXY_USER, PROXY_PASSWORD and PROXY_ALLOWED_HOSTS (comma separated) are all set.
+var forward *proxy.ForwardProxy
+
 func main() {
-	server, err := server.Serve(port, handler)
+	fsys, err := fileserver.Dir("./assets")
+	if err != nil {
+		log.Fatalf("Error opening assets: %v", err)
+	}
+	assets = fileserver.New(fsys, fileserver.WithPrefix("/assets"))
+
+	upstream, err := proxy.New("https://httpbin.org", proxy.WithStripPrefix("/httpbin"))
+	if err != nil {
+		log.Fatalf("Error creating proxy: %v", err)
+	}
+	httpbin = cache.Middleware(upstream.Handle)
+
+	if targets := os.Getenv("BACKENDS"); targets != "" {
+		pool, err := proxy.NewPool(strings.Split(targets, ","),
+			proxy.WithStripPrefix("/backends"),
+			proxy.WithStrategy(proxy.LeastConnections()),
+			proxy.WithHealthCheck(cmp.Or(os.Getenv("BACKENDS_HEALTH_PATH"), "/"), 5*time.Second),
+			proxy.WithSlowStart(30*time.Second))
+		if err != nil {
+			log.Fatalf("Error creating backend pool: %v", err)
+		}
+		defer pool.Close()
+		backends = pool.Handle
+		log.Println("Balancing /backends/ over", targets)
+	}
+
+	user, password, hosts := os.Getenv("PROXY_USER"), os.Getenv("PROXY_PASSWORD"), os.Getenv("PROXY_ALLOWED_HOSTS")
+	if user != "" && password != "" && hosts != "" {
+		forward = proxy.NewForward(proxy.WithProxyAuth(user, password), proxy.WithAllowedHosts(strings.Split(hosts, ",")...))
+		log.Println("Forward proxy enabled for", hosts)
+	}
+
+	server, err := server.Serve(port, compression.Middleware(handler, compression.WithZstd()))
 	if err != nil {
 		log.Fatalf("Error starting server: %v", err)
 	}
@@ -35,6 +86,15 @@ func main() {
 }
 
 func handler(w *response.Writer, req *request.Request) {
+	if proxy.IsProxyRequest(req) {
+		if forward == nil {
+			handle403(w, req)
+			return
+		}
+		forward.Handle(w, req)
+		return
+	}
+
 	t := req.RequestLine.RequestTarget
 	if strings.HasPrefix(t, "/yourproblem") {
 		handle400(w, req)
@@ -47,19 +107,45 @@ func handler(w *response.Writer, req *request.Request) {
 	}
 
 	if strings.HasPrefix(t, "/httpbin/") {
-		handleProxy(w, req)
+		httpbin(w, req)
 		return
 	}
 
-	if strings.HasPrefix(t, "/video") {
+	if strings.HasPrefix(t, "/backends/") && backends != nil {
+		backends(w, req)
+		return
+	}
+
+	if strings.HasPrefix(t, "/assets/") {
+		assets(w, req)
+		return
+	}
+
+	if p, _, _ := strings.Cut(t, "?"); p == "/video" {
 		handleVideo(w, req)
 		return
 	}
 
+	if strings.HasPrefix(t, "/events") {
+		handleEvents(w, req)
+		return
+	}
+
+	if strings.HasPrefix(t, "/ws") {
+		handleWebSocket(w, req)
+		return
+	}
+
 	handle200(w, req)
 }
 
-func handle200(w *response.Writer, _ *request.Request) {
+func handle200(w *response.Writer, req *request.Request) {
+	contentType, err := negotiation.ContentType(req, "text/html", "application/json", "text/plain")
+	if err != nil {
+		handle406(w, req)
+		return
+	}
+
 	bodyBytes := []byte(`<html>
   <head>
     <title>200 OK</title>
@@ -70,8 +156,25 @@ func handle200(w *response.Writer, _ *request.Request) {
   </body>
 </html>
 `)
+	switch contentType {
+	case "application/json":
+		bodyBytes = []byte(`{"status":200,"message":"Your request was an absolute banger."}` + "\n")
+	case "text/plain":
+		bodyBytes = []byte("Success! Your request was an absolute banger.\n")
+	}
+
+	// each variant gets its own tag, so a cached html page never validates a json one
+	negotiation.Vary(w.Header(), negotiation.HeaderAccept)
+	w.Header().Set("ETag", response.StrongETag(bodyBytes))
+	if done, err := response.CheckPreconditions(w, req, time.Time{}); done {
+		if err != nil {
+			log.Printf("Error writing conditional response: %s", err)
+		}
+		return
+	}
+
 	headers := response.GetDefaultHeaders(len(bodyBytes))
-	headers.Set("Content-Type", "text/html")
+	headers.Set("Content-Type", contentType)
 
 	w.WriteStatusLine(response.StatusOk)
 	w.WriteHeaders(headers)
@@ -97,6 +200,45 @@ func handle400(w *response.Writer, _ *request.Request) {
 	w.WriteBody(bodyBytes)
 }
 
+func handle403(w *response.Writer, _ *request.Request) {
+	bodyBytes := []byte(`<html>
+  <head>
+    <title>403 Forbidden</title>
+  </head>
+  <body>
+    <h1>Forbidden</h1>
+    <p>This server is not your proxy.</p>
+  </body>
+</html>
+`)
+	headers := response.GetDefaultHeaders(len(bodyBytes))
+	headers.Set("Content-Type", "text/html")
+
+	w.WriteStatusLine(response.StatusForbidden)
+	w.WriteHeaders(headers)
+	w.WriteBody(bodyBytes)
+}
+
+func handle406(w *response.Writer, _ *request.Request) {
+	bodyBytes := []byte(`<html>
+  <head>
+    <title>406 Not Acceptable</title>
+  </head>
+  <body>
+    <h1>Not Acceptable</h1>
+    <p>We only speak HTML, JSON and plain text.</p>
+  </body>
+</html>
+`)
+	headers := response.GetDefaultHeaders(len(bodyBytes))
+	headers.Set("Content-Type", "text/html")
+	negotiation.Vary(headers, negotiation.HeaderAccept)
+
+	w.WriteStatusLine(response.StatusNotAcceptable)
+	w.WriteHeaders(headers)
+	w.WriteBody(bodyBytes)
+}
+
 func handle500(w *response.Writer, req *request.Request) {
 	bodyBytes := []byte(`<html>
   <head>
@@ -116,98 +258,76 @@ func handle500(w *response.Writer, req *request.Request) {
 	w.WriteBody(bodyBytes)
 }
 
-func handleProxy(w *response.Writer, req *request.Request) {
-	path := strings.TrimPrefix(req.RequestLine.RequestTarget, "/httpbin/")
-	target := fmt.Sprintf("https://httpbin.org/%s", path)
-
-	log.Printf("Proxy target: %s", target)
+func handleVideo(w *response.Writer, req *request.Request) {
+	// serve from a copy, so anything after this handler sees the target the client sent
+	line := *req.RequestLine
+	line.RequestTarget = "/assets/vim.mp4"
+	video := *req
+	video.RequestLine = &line
+	assets(w, &video)
+}
 
-	// proxy to https://httpbin.org/x
-	resp, err := http.Get(target)
-	if err != nil {
-		log.Printf("Error making GET request: %s", err)
-		handle500(w, req)
+func handleEvents(w *response.Writer, req *request.Request) {
+	stream, err := sse.NewStream(w, req)
+	if errors.Is(err, sse.ErrHeadRequest) {
 		return
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("Request failed with status: %s", resp.Status)
-		handle500(w, req)
+	if err != nil {
+		log.Printf("Error opening event stream: %s", err)
 		return
 	}
-
-	// response
-	h := response.GetDefaultHeaders(0)
-	h.Remove("Content-Length")
-	h.Set("Transfer-Encoding", "chunked")
-	h.Add("Trailer", "X-Content-Sha256")
-	h.Add("Trailer", "X-Content-Length")
-
-	w.WriteStatusLine(response.StatusOk)
-	w.WriteHeaders(h)
-
-	const maxChunkSize = 1024
-	buf := make([]byte, maxChunkSize)
-	hasher := sha256.New()
-	nTotal := 0
-
-	// write to response body in chunk
-	for {
-		n, err := resp.Body.Read(buf)
-		nTotal += n
-		log.Printf("Read %d bytes", n)
-		if err != nil {
-			if errors.Is(err, io.EOF) {
-				log.Printf("Reach the end of file")
-			} else {
-				log.Printf("Error reading response from target: %s", err)
+	defer stream.Close()
+
+	// carry on counting from where a reconnecting client left off
+	id, _ := strconv.Atoi(stream.LastEventID())
+
+	events := make(chan sse.Event)
+	go func() {
+		defer close(events)
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case now := <-ticker.C:
+				id++
+				e := sse.Event{ID: strconv.Itoa(id), Event: "tick", Data: now.Format(time.RFC3339)}
+				select {
+				case events <- e:
+				case <-stream.Done():
+					return
+				}
+			case <-stream.Done():
+				return
 			}
-			break
 		}
+	}()
 
-		// write chunk to body
-		chunk := buf[:n]
-
-		_, err = w.WriteChunkBody(chunk)
-		if err != nil {
-			log.Printf("Error writing chunk body: %s", err)
-			break
-		}
-
-		// update hash
-		_, err = hasher.Write(chunk)
-		if err != nil {
-			log.Printf("Error hashing a chunk: %s", err)
-			break
-		}
+	if err := stream.Run(events, sse.DefaultHeartbeat); err != nil {
+		log.Printf("Event stream ended: %s", err)
 	}
-
-	// write closing chunk to body
-	_, err = w.WriteChunkBodyDone()
-	if err != nil {
-		log.Printf("Error writing body done: %s", err)
-	}
-
-	// write trailer
-	trailer := headers.NewHeaders()
-	trailer.Set("X-Content-Sha256", fmt.Sprintf("%x", hasher.Sum(nil)))
-	trailer.Set("X-Content-Length", fmt.Sprintf("%d", nTotal))
-	w.WriteTrailers(trailer)
 }
 
-func handleVideo(w *response.Writer, req *request.Request) {
-	h := response.GetDefaultHeaders(0)
-	h.Remove("Content-Length")
-	h.Set("Content-Type", "video/mp4")
-
-	w.WriteStatusLine(response.StatusOk)
-	w.WriteHeaders(h)
-
-	vid, err := os.ReadFile("./assets/vim.mp4")
+func handleWebSocket(w *response.Writer, req *request.Request) {
+	conn, err := websocket.Upgrade(w, req)
 	if err != nil {
-		handle500(w, req)
+		log.Printf("Error upgrading to websocket: %s", err)
+		return
 	}
 
-	w.WriteBody(vid)
+	// the handler owns the connection after the upgrade, so it can outlive this call
+	go func() {
+		defer conn.NetConn().Close()
+		for {
+			op, msg, err := conn.ReadMessage()
+			if err != nil {
+				log.Printf("Websocket closed: %s", err)
+				return
+			}
+			if err := conn.WriteMessage(op, msg); err != nil {
+				log.Printf("Error echoing websocket message: %s", err)
+				return
+			}
+		}
+	}()
 }
@@ -0,0 +1,583 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Supasiti/prac-go-http-protocol/internal/cachecontrol"
+	"github.com/Supasiti/prac-go-http-protocol/internal/headers"
+	"github.com/Supasiti/prac-go-http-protocol/internal/request"
+	"github.com/Supasiti/prac-go-http-protocol/internal/response"
+	"github.com/Supasiti/prac-go-http-protocol/internal/server"
+)
+
+// DefaultMaxEntrySize is the largest body the cache stores
+const DefaultMaxEntrySize = 1 << 20
+
+const copyBufferSize = 32 * 1024
+
+const HeaderCacheStatus = "Cache-Status"
+
+// conditionalFields are the request fields the cache answers itself, rather than passing
+// them to the handler
+var conditionalFields = []string{
+	"If-Match",
+	"If-None-Match",
+	"If-Modified-Since",
+	"If-Unmodified-Since",
+	"If-Range",
+}
+
+// Cache is a shared HTTP cache (RFC 9111) in front of a handler
+type Cache struct {
+	next         server.Handler
+	store        Store
+	name         string
+	maxEntrySize int
+
+	now func() time.Time
+	wg  sync.WaitGroup // background revalidations
+
+	mu           sync.Mutex
+	revalidating map[string]bool
+}
+
+type Option func(*Cache)
+
+// WithStore sets where responses are kept, a MemoryStore of DefaultMaxSize otherwise
+func WithStore(s Store) Option {
+	return func(c *Cache) {
+		c.store = s
+	}
+}
+
+// WithName sets the name the cache goes by in Cache-Status
+func WithName(name string) Option {
+	return func(c *Cache) {
+		c.name = name
+	}
+}
+
+// WithMaxEntrySize changes the largest body that is stored
+func WithMaxEntrySize(n int) Option {
+	return func(c *Cache) {
+		c.maxEntrySize = n
+	}
+}
+
+func New(next server.Handler, opts ...Option) *Cache {
+	c := &Cache{
+		next:         next,
+		name:         server.DefaultServerName,
+		maxEntrySize: DefaultMaxEntrySize,
+		now:          time.Now,
+		revalidating: make(map[string]bool),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.store == nil {
+		c.store = NewMemoryStore(DefaultMaxSize)
+	}
+	return c
+}
+
+// Middleware serves GET and HEAD requests from the responses of next it has stored, and
+// stores the ones it may. Responses from next are sent on as they arrive; a copy is kept
+// only of those with a Content-Length within the entry size limit. Upgrades and event
+// streams are passed straight through.
+func Middleware(next server.Handler, opts ...Option) server.Handler {
+	return New(next, opts...).Handle
+}
+
+// Handle has the signature of server.Handler
+func (c *Cache) Handle(w *response.Writer, req *request.Request) {
+	method := req.RequestLine.Method
+	if method != "GET" && method != "HEAD" {
+		c.next(w, req)
+		if isUnsafe(method) && w.Status() != 0 && w.Status() < response.StatusBadRequest {
+			// the stored response is likely out of date now (RFC 9111 4.4)
+			c.store.Delete(c.key(req))
+		}
+		return
+	}
+	if req.Headers.Get("Upgrade") != "" || req.Headers.Get("Range") != "" ||
+		strings.Contains(req.Headers.Get("Accept"), "text/event-stream") {
+		c.next(w, req)
+		return
+	}
+
+	key := c.key(req)
+	now := c.now()
+	reqCC := requestCacheControl(req)
+
+	entries := c.store.Get(key)
+	var stored *Entry
+	for _, e := range entries {
+		if e.matches(req) {
+			stored = e
+			break
+		}
+	}
+
+	if stored == nil {
+		fwd := "uri-miss"
+		if len(entries) > 0 {
+			fwd = "vary-miss"
+		}
+		if reqCC.OnlyIfCached {
+			c.gatewayTimeout(w)
+			return
+		}
+		c.forward(w, req, key, nil, status{fwd: fwd})
+		return
+	}
+
+	resCC := cachecontrol.Parse(stored.Headers)
+	age := stored.age(now)
+	ttl := stored.freshnessLifetime() - age
+	stale := -ttl
+
+	switch {
+	case reqCC.NoCache:
+		if reqCC.OnlyIfCached {
+			c.gatewayTimeout(w)
+			return
+		}
+		c.forward(w, req, key, stored, status{fwd: "request"})
+	case resCC.NoCache:
+		c.forward(w, req, key, stored, status{fwd: "stale"})
+	case ttl > 0 && satisfies(reqCC, age, ttl):
+		c.serve(w, req, stored, status{hit: true, ttl: ttl})
+	case ttl <= 0 && !mustRevalidate(resCC) && (reqCC.MaxStaleAny || (reqCC.MaxStale != cachecontrol.Unset && stale <= seconds(reqCC.MaxStale))):
+		c.serve(w, req, stored, status{hit: true, ttl: ttl, detail: "max-stale"})
+	case ttl <= 0 && !mustRevalidate(resCC) && resCC.StaleWhileRevalidate != cachecontrol.Unset && stale <= seconds(resCC.StaleWhileRevalidate):
+		c.revalidateAsync(key, req, stored)
+		c.serve(w, req, stored, status{hit: true, ttl: ttl, detail: "stale-while-revalidate"})
+	case reqCC.OnlyIfCached:
+		c.gatewayTimeout(w)
+	default:
+		c.forward(w, req, key, stored, status{fwd: "stale"})
+	}
+}
+
+// Wait blocks until background revalidations are done
+func (c *Cache) Wait() {
+	c.wg.Wait()
+}
+
+// forward gets the response from the handler, validating stored if there is one, then
+// stores the result and sends it
+func (c *Cache) forward(w *response.Writer, req *request.Request, key string, stored *Entry, st status) {
+	if req.RequestLine.Method == "HEAD" {
+		// only GET responses are stored, a HEAD just passes through
+		w.Header().Add(HeaderCacheStatus, st.format(c.name))
+		c.next(w, req)
+		return
+	}
+
+	fresh, body, err := c.fetch(req, stored)
+	if err != nil {
+		log.Printf("Error getting response for %s: %s", req.RequestLine.RequestTarget, err)
+		if stored != nil && c.staleIfError(req, stored) {
+			st.detail = "stale-if-error"
+			c.serve(w, req, stored, st)
+			return
+		}
+		c.fetchError(w, err, st)
+		return
+	}
+	st.fwdStatus = fresh.StatusCode
+
+	switch {
+	case stored != nil && fresh.StatusCode == response.StatusNotModified:
+		body.Close()
+		fresh = stored.refresh(fresh)
+		st.stored = c.save(key, req, fresh)
+	case stored != nil && fresh.StatusCode >= response.StatusInternalServerError && c.staleIfError(req, stored):
+		body.Close()
+		st.detail = "stale-if-error"
+		fresh = stored
+	default:
+		c.stream(w, req, key, fresh, body, st)
+		return
+	}
+	if st.stored {
+		st.ttl = fresh.freshnessLifetime() - fresh.age(c.now())
+	}
+	c.serve(w, req, fresh, st)
+}
+
+// revalidateAsync refreshes stored in the background, unless that is happening already
+func (c *Cache) revalidateAsync(key string, req *request.Request, stored *Entry) {
+	c.mu.Lock()
+	if c.revalidating[key] {
+		c.mu.Unlock()
+		return
+	}
+	c.revalidating[key] = true
+	c.mu.Unlock()
+
+	bg := c.outgoing(req, nil)
+	c.wg.Go(func() {
+		defer func() {
+			c.mu.Lock()
+			delete(c.revalidating, key)
+			c.mu.Unlock()
+		}()
+
+		fresh, body, err := c.fetch(bg, stored)
+		if err != nil {
+			log.Printf("Error revalidating %s: %s", req.RequestLine.RequestTarget, err)
+			return
+		}
+		defer body.Close()
+		if fresh.StatusCode == response.StatusNotModified {
+			c.save(key, bg, stored.refresh(fresh))
+			return
+		}
+		if n, err := strconv.Atoi(fresh.Headers.Get("Content-Length")); err != nil || n > c.maxEntrySize || !storable(bg, fresh) {
+			return
+		}
+		if fresh.Body, err = io.ReadAll(body); err != nil {
+			log.Printf("Error revalidating %s: %s", req.RequestLine.RequestTarget, err)
+			return
+		}
+		c.save(key, bg, fresh)
+	})
+}
+
+// fetch runs the handler for req and returns its response once the fields are in, without
+// Body; the body is read from the returned reader as the handler writes it, and the caller
+// closes it. With stored, the request asks the handler whether stored is still current.
+func (c *Cache) fetch(req *request.Request, stored *Entry) (*Entry, io.ReadCloser, error) {
+	out := c.outgoing(req, stored)
+	pr, pw := io.Pipe()
+	w := response.NewWriter(pw)
+	w.SetRequestMethod(out.RequestLine.Method)
+
+	requestTime := c.now()
+	go func() {
+		c.next(w, out)
+		pw.CloseWithError(w.Close())
+	}()
+
+	res, err := response.ResponseFromReader(pr, out.RequestLine.Method)
+	if err != nil {
+		pr.CloseWithError(err)
+		return nil, nil, err
+	}
+	responseTime := c.now()
+
+	h := res.Headers
+	h.Remove("Transfer-Encoding")
+	h.Remove("Trailer")
+	if h.Get("Date") == "" {
+		h.Set("Date", headers.FormatTime(responseTime))
+	}
+	return &Entry{
+		StatusCode:   res.StatusLine.StatusCode,
+		ReasonPhrase: res.StatusLine.ReasonPhrase,
+		Headers:      h,
+		RequestTime:  requestTime,
+		ResponseTime: responseTime,
+	}, &pipeBody{Reader: res.Body, pipe: pr}, nil
+}
+
+// pipeBody is the body of a response the handler is still writing. Closing it stops the
+// handler's writes, should the body not be read to the end.
+type pipeBody struct {
+	io.Reader
+	pipe *io.PipeReader
+}
+
+func (b *pipeBody) Close() error {
+	return b.pipe.Close()
+}
+
+// outgoing copies req for the handler. The client's own conditions are left out, as the
+// cache answers them, and replaced by the validators of stored if there is one.
+func (c *Cache) outgoing(req *request.Request, stored *Entry) *request.Request {
+	h := headers.NewHeaders()
+	for name, value := range req.Headers.Fields() {
+		if !isConditional(name) {
+			h.Set(name, value)
+		}
+	}
+	if stored != nil {
+		if etag := stored.Headers.Get("ETag"); etag != "" {
+			h.Set("If-None-Match", etag)
+		}
+		if lastModified := stored.Headers.Get("Last-Modified"); lastModified != "" {
+			h.Set("If-Modified-Since", lastModified)
+		}
+	}
+
+	line := *req.RequestLine
+	return &request.Request{
+		RequestLine: &line,
+		Headers:     h,
+		Body:        req.Body,
+		RemoteAddr:  req.RemoteAddr,
+	}
+}
+
+// save stores e in place of the variant req selected, if it may be stored
+func (c *Cache) save(key string, req *request.Request, e *Entry) bool {
+	if !storable(req, e) || len(e.Body) > c.maxEntrySize {
+		return false
+	}
+
+	e.Vary = make(map[string]string)
+	for _, name := range varyFields(e.Headers) {
+		e.Vary[name] = normalize(req.Headers.Get(name))
+	}
+
+	entries := []*Entry{e}
+	for _, old := range c.store.Get(key) {
+		if !old.matches(req) {
+			entries = append(entries, old)
+		}
+	}
+	c.store.Put(key, entries)
+	return true
+}
+
+// serve sends e, or 304 when it satisfies the client's conditions
+func (c *Cache) serve(w *response.Writer, req *request.Request, e *Entry, st status) {
+	if e.StatusCode != response.StatusNotModified {
+		w.Header().Set("Content-Length", strconv.Itoa(len(e.Body)))
+	}
+	if c.writeHead(w, req, e, st) {
+		w.WriteBody(e.Body)
+	}
+}
+
+// stream sends fresh as its body arrives from the handler. A copy is kept when the response
+// may be stored and its Content-Length is within the limit, and stored once the body has
+// arrived whole; Cache-Status says stored as soon as that is the plan.
+func (c *Cache) stream(w *response.Writer, req *request.Request, key string, fresh *Entry, body io.ReadCloser, st status) {
+	defer body.Close()
+
+	var capture *bytes.Buffer
+	n, err := strconv.Atoi(fresh.Headers.Get("Content-Length"))
+	if err == nil && n >= 0 && n <= c.maxEntrySize && storable(req, fresh) {
+		capture = bytes.NewBuffer(make([]byte, 0, n))
+		st.stored = true
+		st.ttl = fresh.freshnessLifetime() - fresh.age(c.now())
+	}
+	chunked := err != nil
+	if chunked {
+		w.Header().Set("Transfer-Encoding", "chunked")
+	}
+
+	// without the body the client's conditions were answered, but the copy is still kept
+	send := c.writeHead(w, req, fresh, st)
+	if !send && capture == nil {
+		return
+	}
+
+	buf := make([]byte, copyBufferSize)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			if capture != nil {
+				capture.Write(buf[:n])
+			}
+			if send {
+				if werr := writeBody(w, buf[:n], chunked); werr != nil {
+					log.Printf("Error writing response: %s", werr)
+					return
+				}
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			log.Printf("Error reading response for %s: %s", req.RequestLine.RequestTarget, err)
+			return
+		}
+	}
+
+	if capture != nil {
+		fresh.Body = capture.Bytes()
+		c.save(key, req, fresh)
+	}
+}
+
+// writeBody sends p and flushes it, so the client sees the body as the handler writes it
+func writeBody(w *response.Writer, p []byte, chunked bool) error {
+	var err error
+	if chunked {
+		_, err = w.WriteChunkBody(p)
+	} else {
+		_, err = w.WriteBody(p)
+	}
+	if err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// writeHead sends the status line and fields of e, and reports whether the body follows.
+// It does not once a 304 or 412 has answered the client's conditions, or on error.
+func (c *Cache) writeHead(w *response.Writer, req *request.Request, e *Entry, st status) bool {
+	h := w.Header()
+	for name, value := range e.Headers.Fields() {
+		h.Set(name, value)
+	}
+	if st.hit {
+		h.Set("Age", strconv.Itoa(int(e.age(c.now()).Seconds())))
+	}
+	h.Add(HeaderCacheStatus, st.format(c.name))
+
+	if e.StatusCode.IsSuccess() {
+		lastModified, _ := headers.ParseTime(h.Get("Last-Modified"))
+		if done, err := response.CheckPreconditions(w, req, lastModified); done || err != nil {
+			return false
+		}
+	}
+
+	if err := w.WriteStatusLineReason(e.StatusCode, e.ReasonPhrase); err != nil {
+		log.Printf("Error writing cached response: %s", err)
+		return false
+	}
+	if err := w.WriteHeaders(nil); err != nil {
+		log.Printf("Error writing cached response: %s", err)
+		return false
+	}
+	return true
+}
+
+// staleIfError reports whether stored may stand in for a failed response (RFC 5861 4)
+func (c *Cache) staleIfError(req *request.Request, stored *Entry) bool {
+	resCC := cachecontrol.Parse(stored.Headers)
+	if mustRevalidate(resCC) {
+		return false
+	}
+	stale := -(stored.freshnessLifetime() - stored.age(c.now()))
+	limit := resCC.StaleIfError
+	if reqLimit := requestCacheControl(req).StaleIfError; reqLimit != cachecontrol.Unset {
+		limit = reqLimit
+	}
+	return limit != cachecontrol.Unset && stale <= seconds(limit)
+}
+
+// fetchError answers a request whose response could not be had from the handler, as a
+// gateway would: 504 when it took too long, 502 otherwise
+func (c *Cache) fetchError(w *response.Writer, err error, st status) {
+	code := response.StatusBadGateway
+	st.detail = "fetch-error"
+	if isTimeout(err) {
+		code = response.StatusGatewayTimeout
+		st.detail = "fetch-timeout"
+	}
+	w.Header().Add(HeaderCacheStatus, st.format(c.name))
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(code)
+}
+
+func (c *Cache) gatewayTimeout(w *response.Writer) {
+	w.Header().Add(HeaderCacheStatus, status{fwd: "miss", detail: "only-if-cached"}.format(c.name))
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(response.StatusGatewayTimeout)
+}
+
+// key identifies the target of req. Only GET responses are stored, so the method is not
+// part of it.
+func (c *Cache) key(req *request.Request) string {
+	return strings.ToLower(req.Headers.Get("Host")) + req.RequestLine.RequestTarget
+}
+
+// status describes how the cache handled a request, in the form of Cache-Status
+// (RFC 9211)
+type status struct {
+	hit       bool
+	fwd       string
+	fwdStatus response.StatusCode
+	stored    bool
+	ttl       time.Duration
+	detail    string
+}
+
+func (s status) format(name string) string {
+	parts := []string{name}
+	if s.hit {
+		parts = append(parts, "hit")
+	} else {
+		parts = append(parts, "fwd="+s.fwd)
+	}
+	if s.fwdStatus != 0 {
+		parts = append(parts, fmt.Sprintf("fwd-status=%d", s.fwdStatus))
+	}
+	if s.stored {
+		parts = append(parts, "stored")
+	}
+	if s.hit || s.stored {
+		parts = append(parts, fmt.Sprintf("ttl=%d", int(s.ttl.Seconds())))
+	}
+	if s.detail != "" {
+		parts = append(parts, "detail="+s.detail)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// requestCacheControl reads the request directives, treating Pragma: no-cache as
+// no-cache when there are none (RFC 9111 5.4)
+func requestCacheControl(req *request.Request) *cachecontrol.CacheControl {
+	cc := cachecontrol.Parse(req.Headers)
+	if req.Headers.Get(cachecontrol.HeaderCacheControl) == "" && strings.EqualFold(strings.TrimSpace(req.Headers.Get("Pragma")), "no-cache") {
+		cc.NoCache = true
+	}
+	return cc
+}
+
+// mustRevalidate reports whether a shared cache may never serve the response stale
+func mustRevalidate(cc *cachecontrol.CacheControl) bool {
+	return cc.MustRevalidate || cc.ProxyRevalidate || cc.SMaxAge != cachecontrol.Unset
+}
+
+// satisfies reports whether a fresh response meets the limits the request sets
+func satisfies(cc *cachecontrol.CacheControl, age, ttl time.Duration) bool {
+	if cc.MaxAge != cachecontrol.Unset && age > seconds(cc.MaxAge) {
+		return false
+	}
+	if cc.MinFresh != cachecontrol.Unset && ttl < seconds(cc.MinFresh) {
+		return false
+	}
+	return true
+}
+
+func isConditional(name string) bool {
+	for _, field := range conditionalFields {
+		if strings.EqualFold(name, field) {
+			return true
+		}
+	}
+	return false
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded) ||
+		(errors.As(err, &netErr) && netErr.Timeout())
+}
+
+func isUnsafe(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "TRACE":
+		return false
+	}
+	return true
+}
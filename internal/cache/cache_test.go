@@ -0,0 +1,424 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Supasiti/prac-go-http-protocol/internal/headers"
+	"github.com/Supasiti/prac-go-http-protocol/internal/request"
+	"github.com/Supasiti/prac-go-http-protocol/internal/response"
+	"github.com/Supasiti/prac-go-http-protocol/internal/server"
+)
+
+var start = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// origin answers with fields and body, counting the requests that reach it and keeping
+// the last one
+type origin struct {
+	calls  atomic.Int32
+	last   *request.Request
+	status response.StatusCode
+	fields []string
+	body   string
+}
+
+func (o *origin) handle(w *response.Writer, req *request.Request) {
+	o.calls.Add(1)
+	o.last = req
+	for i := 0; i+1 < len(o.fields); i += 2 {
+		w.Header().Set(o.fields[i], o.fields[i+1])
+	}
+	status := o.status
+	if status == 0 {
+		status = response.StatusOk
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(o.body)))
+	w.WriteHeader(status)
+	w.WriteBody([]byte(o.body))
+}
+
+// newTestCache returns a cache in front of handler with a clock the test moves
+func newTestCache(handler server.Handler, opts ...Option) (*Cache, *time.Time) {
+	now := start
+	c := New(handler, append([]Option{WithName("test")}, opts...)...)
+	c.now = func() time.Time { return now }
+	return c, &now
+}
+
+func newRequest(method, target string, fields ...string) *request.Request {
+	h := headers.NewHeaders()
+	h.Set("Host", "example.com")
+	for i := 0; i+1 < len(fields); i += 2 {
+		h.Set(fields[i], fields[i+1])
+	}
+	return &request.Request{
+		RequestLine: &request.RequestLine{Method: method, RequestTarget: target, HttpVersion: "1.1"},
+		Headers:     h,
+	}
+}
+
+func do(t *testing.T, c *Cache, req *request.Request) (*response.Response, string) {
+	buf := &bytes.Buffer{}
+	w := response.NewWriter(buf)
+	w.SetRequestMethod(req.RequestLine.Method)
+	c.Handle(w, req)
+	require.NoError(t, w.Close())
+
+	res, err := response.ResponseFromReader(buf, req.RequestLine.Method)
+	require.NoError(t, err)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	return res, string(body)
+}
+
+func TestCacheHitAndMiss(t *testing.T) {
+	o := &origin{fields: []string{"Cache-Control", "max-age=60", "Date", headers.FormatTime(start)}, body: "hello"}
+	c, now := newTestCache(o.handle)
+
+	// Test: First request goes to the handler and is stored
+	res, body := do(t, c, newRequest("GET", "/a"))
+	assert.Equal(t, "hello", body)
+	assert.Equal(t, "test; fwd=uri-miss; fwd-status=200; stored; ttl=60", res.Headers.Get("Cache-Status"))
+
+	// Test: Repeat is served from the cache with its age
+	*now = start.Add(20 * time.Second)
+	res, body = do(t, c, newRequest("GET", "/a"))
+	assert.Equal(t, "hello", body)
+	assert.Equal(t, "20", res.Headers.Get("Age"))
+	assert.Equal(t, "test; hit; ttl=40", res.Headers.Get("Cache-Status"))
+	assert.Equal(t, int32(1), o.calls.Load())
+
+	// Test: HEAD is answered from the stored GET
+	res, body = do(t, c, newRequest("HEAD", "/a"))
+	assert.Equal(t, "", body)
+	assert.Equal(t, "5", res.Headers.Get("Content-Length"))
+	assert.Equal(t, int32(1), o.calls.Load())
+
+	// Test: Another target or host is a miss
+	do(t, c, newRequest("GET", "/b"))
+	other := newRequest("GET", "/a")
+	other.Headers.Set("Host", "other.example")
+	do(t, c, other)
+	assert.Equal(t, int32(3), o.calls.Load())
+
+	// Test: Request max-age and min-fresh ask for a fresher response
+	res, _ = do(t, c, newRequest("GET", "/a", "Cache-Control", "max-age=10"))
+	assert.Equal(t, "test; fwd=stale; fwd-status=200; stored; ttl=40", res.Headers.Get("Cache-Status"))
+	*now = start.Add(50 * time.Second)
+	res, _ = do(t, c, newRequest("GET", "/a", "Cache-Control", "min-fresh=20"))
+	assert.Contains(t, res.Headers.Get("Cache-Status"), "fwd=stale")
+	assert.Equal(t, int32(5), o.calls.Load())
+
+	// Test: Unsafe method invalidates the stored response
+	*now = start.Add(55 * time.Second)
+	do(t, c, newRequest("GET", "/a"))
+	assert.Equal(t, int32(5), o.calls.Load())
+	do(t, c, newRequest("POST", "/a"))
+	res, _ = do(t, c, newRequest("GET", "/a"))
+	assert.Contains(t, res.Headers.Get("Cache-Status"), "fwd=uri-miss")
+	assert.Equal(t, int32(7), o.calls.Load())
+}
+
+func TestCacheStorable(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		status response.StatusCode
+		fields []string
+		req    []string
+		want   bool
+	}{
+		{"max-age", response.StatusOk, []string{"Cache-Control", "max-age=10"}, nil, true},
+		{"expires", response.StatusOk, []string{"Expires", headers.FormatTime(start.Add(time.Minute))}, nil, true},
+		{"heuristic status", response.StatusNotFound, nil, nil, true},
+		{"not heuristic without freshness", response.StatusCreated, nil, nil, false},
+		{"explicit freshness on any status", response.StatusCreated, []string{"Cache-Control", "public, max-age=5"}, nil, true},
+		{"no-store", response.StatusOk, []string{"Cache-Control", "no-store, max-age=10"}, nil, false},
+		{"request no-store", response.StatusOk, []string{"Cache-Control", "max-age=10"}, []string{"Cache-Control", "no-store"}, false},
+		{"private", response.StatusOk, []string{"Cache-Control", "private, max-age=10"}, nil, false},
+		{"vary star", response.StatusOk, []string{"Cache-Control", "max-age=10", "Vary", "*"}, nil, false},
+		{"authorization", response.StatusOk, []string{"Cache-Control", "max-age=10"}, []string{"Authorization", "Basic x"}, false},
+		{"authorization with public", response.StatusOk, []string{"Cache-Control", "public, max-age=10"}, []string{"Authorization", "Basic x"}, true},
+		{"partial", response.StatusPartialContent, []string{"Cache-Control", "max-age=10"}, nil, false},
+	} {
+		o := &origin{status: c.status, fields: c.fields, body: "x"}
+		cache, _ := newTestCache(o.handle)
+		res, _ := do(t, cache, newRequest("GET", "/", c.req...))
+		assert.Equal(t, c.want, strings.Contains(res.Headers.Get("Cache-Status"), "stored"), c.name)
+	}
+
+	// Test: Bodies over the limit are not stored
+	o := &origin{fields: []string{"Cache-Control", "max-age=10"}, body: "too long"}
+	c, _ := newTestCache(o.handle, WithMaxEntrySize(4))
+	res, _ := do(t, c, newRequest("GET", "/"))
+	assert.Equal(t, "test; fwd=uri-miss; fwd-status=200", res.Headers.Get("Cache-Status"))
+
+	// Test: Streams and upgrades pass straight through
+	o = &origin{fields: []string{"Cache-Control", "max-age=10"}, body: "x"}
+	c, _ = newTestCache(o.handle)
+	res, _ = do(t, c, newRequest("GET", "/", "Accept", "text/event-stream"))
+	assert.Equal(t, "", res.Headers.Get("Cache-Status"))
+	res, _ = do(t, c, newRequest("GET", "/", "Range", "bytes=0-0"))
+	assert.Equal(t, "", res.Headers.Get("Cache-Status"))
+}
+
+func TestCacheFreshness(t *testing.T) {
+	// Test: Age sent by the handler counts against max-age
+	o := &origin{fields: []string{"Cache-Control", "max-age=60", "Age", "50"}, body: "x"}
+	c, now := newTestCache(o.handle)
+	res, _ := do(t, c, newRequest("GET", "/"))
+	assert.Equal(t, "test; fwd=uri-miss; fwd-status=200; stored; ttl=10", res.Headers.Get("Cache-Status"))
+	*now = start.Add(11 * time.Second)
+	res, _ = do(t, c, newRequest("GET", "/"))
+	assert.Contains(t, res.Headers.Get("Cache-Status"), "fwd=stale")
+
+	// Test: Expires relative to Date
+	o = &origin{fields: []string{"Date", headers.FormatTime(start), "Expires", headers.FormatTime(start.Add(30 * time.Second))}, body: "x"}
+	c, now = newTestCache(o.handle)
+	do(t, c, newRequest("GET", "/"))
+	*now = start.Add(29 * time.Second)
+	res, _ = do(t, c, newRequest("GET", "/"))
+	assert.Equal(t, "test; hit; ttl=1", res.Headers.Get("Cache-Status"))
+
+	// Test: s-maxage wins over max-age and Expires
+	o = &origin{fields: []string{"Cache-Control", "max-age=5, s-maxage=100", "Expires", "0"}, body: "x"}
+	c, now = newTestCache(o.handle)
+	do(t, c, newRequest("GET", "/"))
+	*now = start.Add(90 * time.Second)
+	res, _ = do(t, c, newRequest("GET", "/"))
+	assert.Equal(t, "test; hit; ttl=10", res.Headers.Get("Cache-Status"))
+
+	// Test: Heuristic freshness from Last-Modified
+	o = &origin{fields: []string{"Date", headers.FormatTime(start), "Last-Modified", headers.FormatTime(start.Add(-100 * time.Second))}, body: "x"}
+	c, now = newTestCache(o.handle)
+	res, _ = do(t, c, newRequest("GET", "/"))
+	assert.Equal(t, "test; fwd=uri-miss; fwd-status=200; stored; ttl=10", res.Headers.Get("Cache-Status"))
+	*now = start.Add(5 * time.Second)
+	res, _ = do(t, c, newRequest("GET", "/"))
+	assert.Equal(t, "test; hit; ttl=5", res.Headers.Get("Cache-Status"))
+}
+
+func TestCacheVary(t *testing.T) {
+	o := &origin{fields: []string{"Cache-Control", "max-age=60", "Vary", "Accept-Language"}}
+	c, _ := newTestCache(func(w *response.Writer, req *request.Request) {
+		o.body = "lang=" + req.Headers.Get("Accept-Language")
+		o.handle(w, req)
+	})
+
+	// Test: Each variant is stored
+	_, body := do(t, c, newRequest("GET", "/", "Accept-Language", "en"))
+	assert.Equal(t, "lang=en", body)
+	res, body := do(t, c, newRequest("GET", "/", "Accept-Language", "fr"))
+	assert.Equal(t, "lang=fr", body)
+	assert.Contains(t, res.Headers.Get("Cache-Status"), "fwd=vary-miss")
+
+	// Test: Matching variant is selected, whitespace aside
+	res, body = do(t, c, newRequest("GET", "/", "Accept-Language", "en"))
+	assert.Equal(t, "lang=en", body)
+	assert.Contains(t, res.Headers.Get("Cache-Status"), "hit")
+	_, body = do(t, c, newRequest("GET", "/", "Accept-Language", "fr"))
+	assert.Equal(t, "lang=fr", body)
+	assert.Equal(t, int32(2), o.calls.Load())
+
+	// Test: Missing field is a variant of its own
+	_, body = do(t, c, newRequest("GET", "/"))
+	assert.Equal(t, "lang=", body)
+	assert.Equal(t, int32(3), o.calls.Load())
+}
+
+func TestCacheRevalidation(t *testing.T) {
+	etag := `"v1"`
+	o := &origin{}
+	c, now := newTestCache(func(w *response.Writer, req *request.Request) {
+		if req.Headers.Get("If-None-Match") == etag {
+			o.status = response.StatusNotModified
+			o.body = ""
+		} else {
+			o.status = response.StatusOk
+			o.body = "content"
+		}
+		o.handle(w, req)
+	})
+	o.fields = []string{"Cache-Control", "max-age=10", "ETag", etag, "X-Version", "1"}
+
+	// Test: Stale response is validated with its ETag and refreshed by 304
+	do(t, c, newRequest("GET", "/"))
+	*now = start.Add(15 * time.Second)
+	o.fields = []string{"Cache-Control", "max-age=10", "ETag", etag, "X-Version", "2"}
+	res, body := do(t, c, newRequest("GET", "/"))
+	assert.Equal(t, response.StatusOk, res.StatusLine.StatusCode)
+	assert.Equal(t, "content", body)
+	assert.Equal(t, "2", res.Headers.Get("X-Version"))
+	assert.Equal(t, "7", res.Headers.Get("Content-Length"))
+	assert.Equal(t, etag, o.last.Headers.Get("If-None-Match"))
+	assert.Equal(t, "test; fwd=stale; fwd-status=304; stored; ttl=10", res.Headers.Get("Cache-Status"))
+
+	// Test: Refreshed response is fresh again
+	*now = start.Add(20 * time.Second)
+	res, _ = do(t, c, newRequest("GET", "/"))
+	assert.Equal(t, "test; hit; ttl=5", res.Headers.Get("Cache-Status"))
+	assert.Equal(t, int32(2), o.calls.Load())
+
+	// Test: Client's own condition is answered by the cache
+	res, body = do(t, c, newRequest("GET", "/", "If-None-Match", etag))
+	assert.Equal(t, response.StatusNotModified, res.StatusLine.StatusCode)
+	assert.Equal(t, "", body)
+	assert.Equal(t, int32(2), o.calls.Load())
+
+	// Test: Request no-cache forces validation
+	res, _ = do(t, c, newRequest("GET", "/", "Cache-Control", "no-cache"))
+	assert.Contains(t, res.Headers.Get("Cache-Status"), "fwd=request; fwd-status=304")
+	res, _ = do(t, c, newRequest("GET", "/", "Pragma", "no-cache"))
+	assert.Contains(t, res.Headers.Get("Cache-Status"), "fwd=request")
+	assert.Equal(t, int32(4), o.calls.Load())
+
+	// Test: Response no-cache is validated every time
+	o2 := &origin{fields: []string{"Cache-Control", "no-cache", "ETag", etag}, body: "x"}
+	c2, _ := newTestCache(o2.handle)
+	do(t, c2, newRequest("GET", "/"))
+	res, _ = do(t, c2, newRequest("GET", "/"))
+	assert.Contains(t, res.Headers.Get("Cache-Status"), "fwd=stale")
+	assert.Equal(t, etag, o2.last.Headers.Get("If-None-Match"))
+}
+
+func TestCacheStale(t *testing.T) {
+	var version atomic.Int32
+	var failing atomic.Bool
+	handler := func(cc string) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			if failing.Load() {
+				w.Header().Set("Content-Length", "0")
+				w.WriteHeader(response.StatusServiceUnavailable)
+				return
+			}
+			body := "v" + strconv.Itoa(int(version.Add(1)))
+			w.Header().Set("Cache-Control", cc)
+			w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+			w.WriteHeader(response.StatusOk)
+			w.WriteBody([]byte(body))
+		}
+	}
+
+	// Test: Stale served at once while it is revalidated in the background
+	c, now := newTestCache(handler("max-age=10, stale-while-revalidate=30"))
+	do(t, c, newRequest("GET", "/"))
+	*now = start.Add(20 * time.Second)
+	res, body := do(t, c, newRequest("GET", "/"))
+	assert.Equal(t, "v1", body)
+	assert.Equal(t, "test; hit; ttl=-10; detail=stale-while-revalidate", res.Headers.Get("Cache-Status"))
+	c.Wait()
+	_, body = do(t, c, newRequest("GET", "/"))
+	assert.Equal(t, "v2", body)
+
+	// Test: Past the window it waits for the handler
+	*now = start.Add(100 * time.Second)
+	res, body = do(t, c, newRequest("GET", "/"))
+	assert.Equal(t, "v3", body)
+	assert.Contains(t, res.Headers.Get("Cache-Status"), "fwd=stale")
+
+	// Test: Stale stands in for an error within stale-if-error
+	version.Store(0)
+	c, now = newTestCache(handler("max-age=10, stale-if-error=60"))
+	do(t, c, newRequest("GET", "/"))
+	failing.Store(true)
+	*now = start.Add(30 * time.Second)
+	res, body = do(t, c, newRequest("GET", "/"))
+	assert.Equal(t, response.StatusOk, res.StatusLine.StatusCode)
+	assert.Equal(t, "v1", body)
+	assert.Equal(t, "test; fwd=stale; fwd-status=503; detail=stale-if-error", res.Headers.Get("Cache-Status"))
+	*now = start.Add(100 * time.Second)
+	res, _ = do(t, c, newRequest("GET", "/"))
+	assert.Equal(t, response.StatusServiceUnavailable, res.StatusLine.StatusCode)
+	failing.Store(false)
+
+	// Test: max-stale accepts a stale response, unless it must be revalidated
+	c, now = newTestCache(handler("max-age=10"))
+	do(t, c, newRequest("GET", "/"))
+	*now = start.Add(15 * time.Second)
+	res, _ = do(t, c, newRequest("GET", "/", "Cache-Control", "max-stale=10"))
+	assert.Equal(t, "test; hit; ttl=-5; detail=max-stale", res.Headers.Get("Cache-Status"))
+	c, now = newTestCache(handler("max-age=10, must-revalidate"))
+	do(t, c, newRequest("GET", "/"))
+	*now = start.Add(15 * time.Second)
+	res, _ = do(t, c, newRequest("GET", "/", "Cache-Control", "max-stale"))
+	assert.Contains(t, res.Headers.Get("Cache-Status"), "fwd=stale")
+
+	// Test: only-if-cached without a usable response
+	res, _ = do(t, c, newRequest("GET", "/other", "Cache-Control", "only-if-cached"))
+	assert.Equal(t, response.StatusGatewayTimeout, res.StatusLine.StatusCode)
+	*now = start.Add(100 * time.Second)
+	res, _ = do(t, c, newRequest("GET", "/", "Cache-Control", "only-if-cached"))
+	assert.Equal(t, response.StatusGatewayTimeout, res.StatusLine.StatusCode)
+}
+
+func TestCacheStreaming(t *testing.T) {
+	release := make(chan struct{})
+	c, _ := newTestCache(func(w *response.Writer, req *request.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Transfer-Encoding", "chunked")
+		w.WriteHeader(response.StatusOk)
+		w.WriteChunkBody([]byte("first,"))
+		w.Flush()
+		<-release
+		w.WriteChunkBody([]byte("last"))
+	})
+
+	// Test: Body reaches the client while the handler is still writing
+	pr, pw := io.Pipe()
+	go func() {
+		w := response.NewWriter(pw)
+		c.Handle(w, newRequest("GET", "/stream"))
+		pw.CloseWithError(w.Close())
+	}()
+	res, err := response.ResponseFromReader(pr, "GET")
+	require.NoError(t, err)
+	assert.Equal(t, "test; fwd=uri-miss; fwd-status=200", res.Headers.Get("Cache-Status"))
+	first := make([]byte, len("first,"))
+	_, err = io.ReadFull(res.Body, first)
+	require.NoError(t, err)
+	assert.Equal(t, "first,", string(first))
+	close(release)
+	rest, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "last", string(rest))
+
+	// Test: Body without a Content-Length is not stored
+	res, _ = do(t, c, newRequest("GET", "/stream"))
+	assert.Contains(t, res.Headers.Get("Cache-Status"), "fwd=uri-miss")
+
+	// Test: Body over the limit is sent whole but not stored
+	o := &origin{fields: []string{"Cache-Control", "max-age=10"}, body: strings.Repeat("x", 100)}
+	c, _ = newTestCache(o.handle, WithMaxEntrySize(10))
+	_, body := do(t, c, newRequest("GET", "/"))
+	assert.Equal(t, o.body, body)
+	do(t, c, newRequest("GET", "/"))
+	assert.Equal(t, int32(2), o.calls.Load())
+}
+
+func TestCacheFetchError(t *testing.T) {
+	// Test: Handler giving no response is a bad gateway, saying why
+	c, _ := newTestCache(func(w *response.Writer, req *request.Request) {})
+	res, body := do(t, c, newRequest("GET", "/"))
+	assert.Equal(t, response.StatusBadGateway, res.StatusLine.StatusCode)
+	assert.Equal(t, "", body)
+	assert.Equal(t, "test; fwd=uri-miss; detail=fetch-error", res.Headers.Get("Cache-Status"))
+
+	// Test: Timeouts are a gateway timeout
+	buf := &bytes.Buffer{}
+	w := response.NewWriter(buf)
+	c.fetchError(w, fmt.Errorf("reading response: %w", context.DeadlineExceeded), status{fwd: "stale"})
+	require.NoError(t, w.Close())
+	res, err := response.ResponseFromReader(buf, "GET")
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusGatewayTimeout, res.StatusLine.StatusCode)
+	assert.Equal(t, "test; fwd=stale; detail=fetch-timeout", res.Headers.Get("Cache-Status"))
+}
@@ -0,0 +1,171 @@
+package cache
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Supasiti/prac-go-http-protocol/internal/cachecontrol"
+	"github.com/Supasiti/prac-go-http-protocol/internal/headers"
+	"github.com/Supasiti/prac-go-http-protocol/internal/request"
+	"github.com/Supasiti/prac-go-http-protocol/internal/response"
+)
+
+const (
+	// heuristicFraction of the time since Last-Modified is the freshness lifetime of a
+	// response that gives none (RFC 9111 4.2.2)
+	heuristicFraction = 0.1
+	maxHeuristic      = 24 * time.Hour
+)
+
+// heuristicallyCacheable lists the status codes a cache may store without explicit
+// freshness (RFC 9110 15.1)
+var heuristicallyCacheable = []response.StatusCode{
+	response.StatusOk,
+	response.StatusNonAuthoritativeInfo,
+	response.StatusNoContent,
+	response.StatusMultipleChoices,
+	response.StatusMovedPermanently,
+	response.StatusPermanentRedirect,
+	response.StatusNotFound,
+	response.StatusMethodNotAllowed,
+	response.StatusGone,
+	response.StatusURITooLong,
+	response.StatusNotImplemented,
+}
+
+// storable reports whether a shared cache may keep the response e to req (RFC 9111 3).
+// Partial and not modified responses are left out, as the cache only stores whole ones.
+func storable(req *request.Request, e *Entry) bool {
+	if req.RequestLine.Method != "GET" {
+		return false
+	}
+	code := e.StatusCode
+	if code.IsInformational() || code == response.StatusPartialContent || code == response.StatusNotModified {
+		return false
+	}
+
+	reqCC := cachecontrol.Parse(req.Headers)
+	resCC := cachecontrol.Parse(e.Headers)
+	if reqCC.NoStore || resCC.NoStore || resCC.Private {
+		return false
+	}
+	if req.Headers.Get("Authorization") != "" && !resCC.Public && !resCC.MustRevalidate && resCC.SMaxAge == cachecontrol.Unset {
+		return false
+	}
+	if slices.Contains(varyFields(e.Headers), "*") {
+		return false
+	}
+
+	return resCC.Public || resCC.MaxAge != cachecontrol.Unset || resCC.SMaxAge != cachecontrol.Unset ||
+		e.Headers.Get("Expires") != "" || slices.Contains(heuristicallyCacheable, code)
+}
+
+// freshnessLifetime is how long e stays fresh after it was generated (RFC 9111 4.2.1)
+func (e *Entry) freshnessLifetime() time.Duration {
+	cc := cachecontrol.Parse(e.Headers)
+	if cc.SMaxAge != cachecontrol.Unset {
+		return seconds(cc.SMaxAge)
+	}
+	if cc.MaxAge != cachecontrol.Unset {
+		return seconds(cc.MaxAge)
+	}
+	if raw := e.Headers.Get("Expires"); raw != "" {
+		expires, err := headers.ParseTime(raw)
+		if err != nil {
+			// an invalid date means already expired
+			return 0
+		}
+		return expires.Sub(e.date())
+	}
+
+	if !slices.Contains(heuristicallyCacheable, e.StatusCode) {
+		return 0
+	}
+	lastModified, err := headers.ParseTime(e.Headers.Get("Last-Modified"))
+	if err != nil {
+		return 0
+	}
+	since := e.date().Sub(lastModified)
+	if since <= 0 {
+		return 0
+	}
+	return min(time.Duration(float64(since)*heuristicFraction), maxHeuristic)
+}
+
+// age estimates how long ago e was generated by the origin, at now (RFC 9111 4.2.3)
+func (e *Entry) age(now time.Time) time.Duration {
+	apparentAge := max(0, e.ResponseTime.Sub(e.date()))
+
+	ageValue := time.Duration(0)
+	if n, err := strconv.Atoi(strings.TrimSpace(e.Headers.Get("Age"))); err == nil && n > 0 {
+		ageValue = seconds(n)
+	}
+	responseDelay := e.ResponseTime.Sub(e.RequestTime)
+	correctedAgeValue := ageValue + responseDelay
+
+	correctedInitialAge := max(apparentAge, correctedAgeValue)
+	residentTime := now.Sub(e.ResponseTime)
+	return correctedInitialAge + residentTime
+}
+
+// date is when the origin generated e, or when it arrived if it does not say
+func (e *Entry) date() time.Time {
+	if t, err := headers.ParseTime(e.Headers.Get("Date")); err == nil {
+		return t
+	}
+	return e.ResponseTime
+}
+
+// refresh returns e with the fields of the 304 response that validated it merged in
+// (RFC 9111 4.3.4)
+func (e *Entry) refresh(notModified *Entry) *Entry {
+	h := headers.NewHeaders()
+	for name, value := range e.Headers.Fields() {
+		h.Set(name, value)
+	}
+	for name, value := range notModified.Headers.Fields() {
+		if strings.EqualFold(name, "Content-Length") || strings.EqualFold(name, "Transfer-Encoding") {
+			continue
+		}
+		h.Set(name, value)
+	}
+
+	refreshed := *e
+	refreshed.Headers = h
+	refreshed.RequestTime = notModified.RequestTime
+	refreshed.ResponseTime = notModified.ResponseTime
+	return &refreshed
+}
+
+// matches reports whether e was selected by request fields equal to those of req
+// (RFC 9111 4.1)
+func (e *Entry) matches(req *request.Request) bool {
+	for _, name := range varyFields(e.Headers) {
+		if name == "*" || normalize(req.Headers.Get(name)) != e.Vary[name] {
+			return false
+		}
+	}
+	return true
+}
+
+// varyFields returns the lowercased field names in the Vary of h
+func varyFields(h *headers.Headers) []string {
+	var names []string
+	for name := range strings.SplitSeq(h.Get("Vary"), ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// normalize folds whitespace, so values differing only in spacing select the same variant
+func normalize(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
+
+func seconds(n int) time.Duration {
+	return time.Duration(n) * time.Second
+}
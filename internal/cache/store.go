@@ -0,0 +1,242 @@
+package cache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Supasiti/prac-go-http-protocol/internal/headers"
+	"github.com/Supasiti/prac-go-http-protocol/internal/response"
+)
+
+// DefaultMaxSize bounds the memory a MemoryStore uses for bodies and fields
+const DefaultMaxSize = 64 << 20
+
+// Entry is a stored response together with what the cache needs to judge its age
+type Entry struct {
+	StatusCode   response.StatusCode
+	ReasonPhrase string
+	Headers      *headers.Headers
+	Body         []byte
+
+	// Vary holds the request fields named in the Vary of the response, lowercased, with
+	// the values the request that got the response sent
+	Vary map[string]string
+
+	RequestTime  time.Time
+	ResponseTime time.Time
+}
+
+func (e *Entry) size() int64 {
+	n := int64(len(e.Body))
+	for name, value := range e.Headers.All() {
+		n += int64(len(name) + len(value))
+	}
+	return n
+}
+
+// Store keeps entries under the cache key of their request, one entry per variant
+// selected by Vary. Entries are not modified once stored; a Store may share them.
+type Store interface {
+	Get(key string) []*Entry
+	Put(key string, entries []*Entry)
+	Delete(key string)
+}
+
+// MemoryStore keeps entries in memory and evicts the least recently used once the total
+// size goes over its limit
+type MemoryStore struct {
+	maxSize int64
+
+	mu    sync.Mutex
+	size  int64
+	items map[string]*list.Element
+	lru   *list.List // most recently used at the front
+}
+
+type memoryItem struct {
+	key     string
+	entries []*Entry
+	size    int64
+}
+
+func NewMemoryStore(maxSize int64) *MemoryStore {
+	return &MemoryStore{
+		maxSize: maxSize,
+		items:   make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+func (s *MemoryStore) Get(key string) []*Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.items[key]
+	if !ok {
+		return nil
+	}
+	s.lru.MoveToFront(elem)
+	return elem.Value.(*memoryItem).entries
+}
+
+func (s *MemoryStore) Put(key string, entries []*Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.remove(key)
+	item := &memoryItem{key: key, entries: entries}
+	for _, e := range entries {
+		item.size += e.size()
+	}
+	if item.size > s.maxSize {
+		return
+	}
+	s.items[key] = s.lru.PushFront(item)
+	s.size += item.size
+
+	for s.size > s.maxSize {
+		s.remove(s.lru.Back().Value.(*memoryItem).key)
+	}
+}
+
+func (s *MemoryStore) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(key)
+}
+
+func (s *MemoryStore) remove(key string) {
+	elem, ok := s.items[key]
+	if !ok {
+		return
+	}
+	s.lru.Remove(elem)
+	delete(s.items, key)
+	s.size -= elem.Value.(*memoryItem).size
+}
+
+// DiskStore keeps entries in files below a directory, so they outlive the process. Each
+// key has a file named after its hash. Nothing is evicted.
+type DiskStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// diskEntry is the form an Entry takes on disk, with the fields in order
+type diskEntry struct {
+	StatusCode   int
+	ReasonPhrase string
+	Fields       [][2]string
+	Body         []byte
+	Vary         map[string]string
+	RequestTime  time.Time
+	ResponseTime time.Time
+}
+
+func NewDiskStore(dir string) (*DiskStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &DiskStore{dir: dir}, nil
+}
+
+func (s *DiskStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:]))
+}
+
+func (s *DiskStore) Get(key string) []*Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.Open(s.path(key))
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Error reading cache entry: %s", err)
+		}
+		return nil
+	}
+	defer f.Close()
+
+	var stored []diskEntry
+	if err := gob.NewDecoder(f).Decode(&stored); err != nil {
+		log.Printf("Error decoding cache entry: %s", err)
+		return nil
+	}
+
+	entries := make([]*Entry, len(stored))
+	for i, d := range stored {
+		h := headers.NewHeaders()
+		for _, field := range d.Fields {
+			h.Set(field[0], field[1])
+		}
+		entries[i] = &Entry{
+			StatusCode:   response.StatusCode(d.StatusCode),
+			ReasonPhrase: d.ReasonPhrase,
+			Headers:      h,
+			Body:         d.Body,
+			Vary:         d.Vary,
+			RequestTime:  d.RequestTime,
+			ResponseTime: d.ResponseTime,
+		}
+	}
+	return entries
+}
+
+func (s *DiskStore) Put(key string, entries []*Entry) {
+	stored := make([]diskEntry, len(entries))
+	for i, e := range entries {
+		d := diskEntry{
+			StatusCode:   int(e.StatusCode),
+			ReasonPhrase: e.ReasonPhrase,
+			Body:         e.Body,
+			Vary:         e.Vary,
+			RequestTime:  e.RequestTime,
+			ResponseTime: e.ResponseTime,
+		}
+		for name, value := range e.Headers.Fields() {
+			d.Fields = append(d.Fields, [2]string{name, value})
+		}
+		stored[i] = d
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// write aside and rename, so a reader never sees half an entry
+	f, err := os.CreateTemp(s.dir, ".entry-*")
+	if err != nil {
+		log.Printf("Error writing cache entry: %s", err)
+		return
+	}
+	defer os.Remove(f.Name())
+
+	err = gob.NewEncoder(f).Encode(stored)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), s.path(key))
+	}
+	if err != nil {
+		log.Printf("Error writing cache entry: %s", err)
+	}
+}
+
+func (s *DiskStore) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.Remove(s.path(key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("Error removing cache entry: %s", err)
+	}
+}
@@ -0,0 +1,97 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Supasiti/prac-go-http-protocol/internal/headers"
+	"github.com/Supasiti/prac-go-http-protocol/internal/response"
+)
+
+func newEntry(body string) *Entry {
+	h := headers.NewHeaders()
+	h.Set("Content-Type", "text/plain")
+	h.Set("Cache-Control", "max-age=60")
+	return &Entry{
+		StatusCode:   response.StatusOk,
+		ReasonPhrase: "OK",
+		Headers:      h,
+		Body:         []byte(body),
+		Vary:         map[string]string{"accept-language": "en"},
+		RequestTime:  start,
+		ResponseTime: start,
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	entrySize := newEntry("0123456789").size()
+	s := NewMemoryStore(3 * entrySize)
+
+	// Test: Stored and removed
+	s.Put("a", []*Entry{newEntry("0123456789")})
+	require.Len(t, s.Get("a"), 1)
+	assert.Equal(t, "0123456789", string(s.Get("a")[0].Body))
+	s.Delete("a")
+	assert.Nil(t, s.Get("a"))
+
+	// Test: Least recently used is evicted past the limit
+	s.Put("a", []*Entry{newEntry("0123456789")})
+	s.Put("b", []*Entry{newEntry("0123456789")})
+	s.Put("c", []*Entry{newEntry("0123456789")})
+	s.Get("a")
+	s.Put("d", []*Entry{newEntry("0123456789")})
+	assert.NotNil(t, s.Get("a"))
+	assert.Nil(t, s.Get("b"))
+	assert.NotNil(t, s.Get("c"))
+	assert.NotNil(t, s.Get("d"))
+	assert.Equal(t, 3*entrySize, s.size)
+
+	// Test: Replacing a key keeps the size right
+	s.Put("d", []*Entry{newEntry("0123456789"), newEntry("0123456789")})
+	assert.LessOrEqual(t, s.size, 3*entrySize)
+
+	// Test: Entry over the limit is not kept
+	s.Put("big", []*Entry{newEntry(string(make([]byte, 4*entrySize)))})
+	assert.Nil(t, s.Get("big"))
+}
+
+func TestDiskStore(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewDiskStore(dir)
+	require.NoError(t, err)
+
+	// Test: Missing key
+	assert.Nil(t, s.Get("example.com/"))
+
+	// Test: Entries survive a new store on the same directory
+	s.Put("example.com/", []*Entry{newEntry("hello"), newEntry("bonjour")})
+	s, err = NewDiskStore(dir)
+	require.NoError(t, err)
+	entries := s.Get("example.com/")
+	require.Len(t, entries, 2)
+	e := entries[0]
+	assert.Equal(t, response.StatusOk, e.StatusCode)
+	assert.Equal(t, "OK", e.ReasonPhrase)
+	assert.Equal(t, "hello", string(e.Body))
+	assert.Equal(t, "max-age=60", e.Headers.Get("Cache-Control"))
+	assert.Equal(t, "en", e.Vary["accept-language"])
+	assert.True(t, start.Equal(e.ResponseTime))
+	assert.Equal(t, "bonjour", string(entries[1].Body))
+
+	// Test: Deleted
+	s.Delete("example.com/")
+	assert.Nil(t, s.Get("example.com/"))
+	s.Delete("example.com/")
+
+	// Test: Cache on disk serves a stored response
+	o := &origin{fields: []string{"Cache-Control", "max-age=60"}, body: "from disk"}
+	c, _ := newTestCache(o.handle, WithStore(s))
+	do(t, c, newRequest("GET", "/"))
+	c, _ = newTestCache(o.handle, WithStore(s))
+	res, body := do(t, c, newRequest("GET", "/"))
+	assert.Equal(t, "from disk", body)
+	assert.Equal(t, "test; hit; ttl=60", res.Headers.Get("Cache-Status"))
+	assert.Equal(t, int32(1), o.calls.Load())
+}
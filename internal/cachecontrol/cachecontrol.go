@@ -0,0 +1,305 @@
+package cachecontrol
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/Supasiti/prac-go-http-protocol/internal/headers"
+)
+
+const HeaderCacheControl = "Cache-Control"
+
+// Unset marks a delta-seconds directive that is absent
+const Unset = -1
+
+// maxDelta is the largest delta-seconds a recipient has to keep (RFC 9111 1.2.2)
+const maxDelta = math.MaxInt32
+
+type Extension struct {
+	Name  string
+	Value string
+}
+
+// CacheControl holds the directives of a Cache-Control header. The same type is used for
+// request and response directives; fields that do not apply to a message are left unset.
+type CacheControl struct {
+	MaxAge               int
+	SMaxAge              int
+	MaxStale             int
+	MaxStaleAny          bool // max-stale without a value accepts any staleness
+	MinFresh             int
+	StaleWhileRevalidate int
+	StaleIfError         int
+
+	NoCache         bool
+	NoCacheFields   []string
+	NoStore         bool
+	NoTransform     bool
+	OnlyIfCached    bool
+	Private         bool
+	PrivateFields   []string
+	Public          bool
+	MustRevalidate  bool
+	ProxyRevalidate bool
+	MustUnderstand  bool
+	Immutable       bool
+
+	Extensions []Extension
+}
+
+func New() *CacheControl {
+	return &CacheControl{
+		MaxAge:               Unset,
+		SMaxAge:              Unset,
+		MaxStale:             Unset,
+		MinFresh:             Unset,
+		StaleWhileRevalidate: Unset,
+		StaleIfError:         Unset,
+	}
+}
+
+// Parse reads the directives from the Cache-Control field of h
+func Parse(h *headers.Headers) *CacheControl {
+	return ParseString(h.Get(HeaderCacheControl))
+}
+
+// ParseString reads directives from a raw Cache-Control value. Unknown directives are kept
+// as extensions, and only the first occurrence of a known directive is honoured.
+func ParseString(raw string) *CacheControl {
+	c := New()
+	seen := make(map[string]bool)
+
+	for _, elem := range splitDirectives(raw) {
+		name, value, hasValue := strings.Cut(elem, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		value = unquote(strings.TrimSpace(value))
+		if name == "" {
+			continue
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		switch name {
+		case "max-age":
+			c.MaxAge = parseDelta(value)
+		case "s-maxage":
+			c.SMaxAge = parseDelta(value)
+		case "max-stale":
+			if hasValue {
+				c.MaxStale = parseDelta(value)
+			} else {
+				c.MaxStaleAny = true
+			}
+		case "min-fresh":
+			c.MinFresh = parseDelta(value)
+		case "stale-while-revalidate":
+			c.StaleWhileRevalidate = parseDelta(value)
+		case "stale-if-error":
+			c.StaleIfError = parseDelta(value)
+		case "no-cache":
+			c.NoCache = true
+			if hasValue {
+				c.NoCacheFields = parseFieldList(value)
+			}
+		case "no-store":
+			c.NoStore = true
+		case "no-transform":
+			c.NoTransform = true
+		case "only-if-cached":
+			c.OnlyIfCached = true
+		case "private":
+			c.Private = true
+			if hasValue {
+				c.PrivateFields = parseFieldList(value)
+			}
+		case "public":
+			c.Public = true
+		case "must-revalidate":
+			c.MustRevalidate = true
+		case "proxy-revalidate":
+			c.ProxyRevalidate = true
+		case "must-understand":
+			c.MustUnderstand = true
+		case "immutable":
+			c.Immutable = true
+		default:
+			c.Extensions = append(c.Extensions, Extension{Name: name, Value: value})
+		}
+	}
+
+	return c
+}
+
+// Extension returns the value of an unknown directive and whether it was present
+func (c *CacheControl) Extension(name string) (string, bool) {
+	for _, ext := range c.Extensions {
+		if strings.EqualFold(ext.Name, name) {
+			return ext.Value, true
+		}
+	}
+	return "", false
+}
+
+func (c *CacheControl) String() string {
+	parts := make([]string, 0)
+	flag := func(set bool, name string) {
+		if set {
+			parts = append(parts, name)
+		}
+	}
+	delta := func(v int, name string) {
+		if v >= 0 {
+			parts = append(parts, name+"="+strconv.Itoa(v))
+		}
+	}
+	fields := func(set bool, name string, list []string) {
+		switch {
+		case set && len(list) > 0:
+			parts = append(parts, name+`="`+strings.Join(list, ", ")+`"`)
+		case set:
+			parts = append(parts, name)
+		}
+	}
+
+	flag(c.Public, "public")
+	fields(c.Private, "private", c.PrivateFields)
+	fields(c.NoCache, "no-cache", c.NoCacheFields)
+	flag(c.NoStore, "no-store")
+	flag(c.NoTransform, "no-transform")
+	flag(c.OnlyIfCached, "only-if-cached")
+	delta(c.MaxAge, "max-age")
+	delta(c.SMaxAge, "s-maxage")
+	if c.MaxStaleAny {
+		parts = append(parts, "max-stale")
+	} else {
+		delta(c.MaxStale, "max-stale")
+	}
+	delta(c.MinFresh, "min-fresh")
+	flag(c.MustRevalidate, "must-revalidate")
+	flag(c.ProxyRevalidate, "proxy-revalidate")
+	flag(c.MustUnderstand, "must-understand")
+	delta(c.StaleWhileRevalidate, "stale-while-revalidate")
+	delta(c.StaleIfError, "stale-if-error")
+	flag(c.Immutable, "immutable")
+
+	for _, ext := range c.Extensions {
+		if ext.Value == "" {
+			parts = append(parts, ext.Name)
+		} else {
+			parts = append(parts, ext.Name+"="+quoteIfNeeded(ext.Value))
+		}
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// Apply writes the directives to the Cache-Control field of h, removing the field when
+// there is nothing to send.
+func (c *CacheControl) Apply(h *headers.Headers) {
+	value := c.String()
+	if value == "" {
+		h.Remove(HeaderCacheControl)
+		return
+	}
+	h.Set(HeaderCacheControl, value)
+}
+
+// parseDelta reads delta-seconds. Malformed values are treated as 0, which is the most
+// conservative reading for every directive that takes one.
+func parseDelta(s string) int {
+	if s == "" {
+		return 0
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return 0
+		}
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n > maxDelta {
+		return maxDelta
+	}
+	return int(n)
+}
+
+func parseFieldList(s string) []string {
+	fields := make([]string, 0)
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		if f != "" {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// splitDirectives splits on commas outside of quoted strings
+func splitDirectives(s string) []string {
+	parts := make([]string, 0)
+	inQuote := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if inQuote {
+				i++
+			}
+		case '"':
+			inQuote = !inQuote
+		case ',':
+			if !inQuote {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func unquote(s string) string {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 1; i < len(s)-1; i++ {
+		if s[i] == '\\' && i+1 < len(s)-1 {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func quoteIfNeeded(s string) string {
+	for _, r := range s {
+		if !isTokenChar(r) {
+			return quote(s)
+		}
+	}
+	return s
+}
+
+func quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		if s[i] == '"' || s[i] == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+func isTokenChar(r rune) bool {
+	if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+		return true
+	}
+	return strings.ContainsRune("!#$%&'*+-.^_`|~", r)
+}
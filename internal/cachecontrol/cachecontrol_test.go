@@ -0,0 +1,96 @@
+package cachecontrol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Supasiti/prac-go-http-protocol/internal/headers"
+)
+
+func TestParse(t *testing.T) {
+	// Test: Response directives
+	c := ParseString("public, max-age=3600, s-maxage=60, must-revalidate, immutable")
+	assert.True(t, c.Public)
+	assert.Equal(t, 3600, c.MaxAge)
+	assert.Equal(t, 60, c.SMaxAge)
+	assert.True(t, c.MustRevalidate)
+	assert.True(t, c.Immutable)
+	assert.Equal(t, Unset, c.StaleWhileRevalidate)
+
+	// Test: Field lists in quoted strings
+	c = ParseString(`no-cache="Set-Cookie, X-Token", private="Authorization", no-store`)
+	assert.True(t, c.NoCache)
+	assert.Equal(t, []string{"Set-Cookie", "X-Token"}, c.NoCacheFields)
+	assert.True(t, c.Private)
+	assert.Equal(t, []string{"Authorization"}, c.PrivateFields)
+	assert.True(t, c.NoStore)
+
+	// Test: Request directives
+	c = ParseString("max-stale, min-fresh=10, only-if-cached")
+	assert.True(t, c.MaxStaleAny)
+	assert.Equal(t, Unset, c.MaxStale)
+	assert.Equal(t, 10, c.MinFresh)
+	assert.True(t, c.OnlyIfCached)
+
+	// Test: Case insensitive names and quoted delta
+	c = ParseString(`Max-Age="120", STALE-WHILE-REVALIDATE=30`)
+	assert.Equal(t, 120, c.MaxAge)
+	assert.Equal(t, 30, c.StaleWhileRevalidate)
+
+	// Test: Malformed delta is treated as stale and first occurrence wins
+	c = ParseString("max-age=abc, max-age=60")
+	assert.Equal(t, 0, c.MaxAge)
+
+	// Test: Delta overflow is capped
+	c = ParseString("max-age=99999999999999")
+	assert.Equal(t, maxDelta, c.MaxAge)
+
+	// Test: Extensions
+	c = ParseString(`community="UCI", foo`)
+	value, ok := c.Extension("community")
+	require.True(t, ok)
+	assert.Equal(t, "UCI", value)
+	_, ok = c.Extension("foo")
+	assert.True(t, ok)
+
+	// Test: Parse from headers
+	h := headers.NewHeaders()
+	h.Set("Cache-Control", "no-cache")
+	c = Parse(h)
+	assert.True(t, c.NoCache)
+	assert.Empty(t, c.NoCacheFields)
+}
+
+func TestString(t *testing.T) {
+	// Test: Empty directives
+	assert.Equal(t, "", New().String())
+
+	// Test: Zero max-age is kept
+	c := New()
+	c.MaxAge = 0
+	c.NoCache = true
+	assert.Equal(t, "no-cache, max-age=0", c.String())
+
+	// Test: Field lists and extensions
+	c = New()
+	c.Private = true
+	c.PrivateFields = []string{"Set-Cookie", "Authorization"}
+	c.StaleWhileRevalidate = 30
+	c.Extensions = []Extension{{Name: "community", Value: "a b"}, {Name: "foo"}}
+	assert.Equal(t, `private="Set-Cookie, Authorization", stale-while-revalidate=30, community="a b", foo`, c.String())
+
+	// Test: Round trip
+	raw := `public, no-cache="Set-Cookie", max-age=60, max-stale, must-revalidate, immutable`
+	assert.Equal(t, raw, ParseString(raw).String())
+
+	// Test: Apply sets and removes the header
+	h := headers.NewHeaders()
+	c = New()
+	c.NoStore = true
+	c.Apply(h)
+	assert.Equal(t, "no-store", h.Get("Cache-Control"))
+	New().Apply(h)
+	assert.Equal(t, "", h.Get("Cache-Control"))
+}
@@ -0,0 +1,440 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Supasiti/prac-go-http-protocol/internal/headers"
+	"github.com/Supasiti/prac-go-http-protocol/internal/request"
+	"github.com/Supasiti/prac-go-http-protocol/internal/response"
+)
+
+const (
+	DefaultDialTimeout         = 30 * time.Second
+	DefaultIdleTimeout         = 90 * time.Second
+	DefaultMaxIdleConnsPerHost = 2
+)
+
+const bufferSize = 4096
+
+type Client struct {
+	dialTimeout           time.Duration
+	responseHeaderTimeout time.Duration
+	idleTimeout           time.Duration
+	maxIdleConnsPerHost   int
+	tlsConfig             *tls.Config
+	dial                  func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	mu   sync.Mutex
+	idle map[string][]*conn // keyed by scheme://host:port, most recently used last
+}
+
+type Option func(*Client)
+
+// WithDialTimeout limits how long connecting, including the TLS handshake, may take
+func WithDialTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.dialTimeout = d
+	}
+}
+
+// WithResponseHeaderTimeout limits how long to wait for the response headers once the
+// request has been sent. Zero means no limit.
+func WithResponseHeaderTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.responseHeaderTimeout = d
+	}
+}
+
+// WithIdleTimeout sets how long an unused connection is kept for reuse
+func WithIdleTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.idleTimeout = d
+	}
+}
+
+// WithMaxIdleConnsPerHost sets how many unused connections are kept for each host. Zero
+// disables keep-alive.
+func WithMaxIdleConnsPerHost(n int) Option {
+	return func(c *Client) {
+		c.maxIdleConnsPerHost = n
+	}
+}
+
+// WithTLSConfig sets the configuration for https targets
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(c *Client) {
+		c.tlsConfig = cfg
+	}
+}
+
+// WithDialContext sets how connections are opened, in place of a plain net.Dialer. The
+// dial timeout still bounds the TLS handshake.
+func WithDialContext(dial func(ctx context.Context, network, addr string) (net.Conn, error)) Option {
+	return func(c *Client) {
+		c.dial = dial
+	}
+}
+
+func New(opts ...Option) *Client {
+	c := &Client{
+		dialTimeout:         DefaultDialTimeout,
+		idleTimeout:         DefaultIdleTimeout,
+		maxIdleConnsPerHost: DefaultMaxIdleConnsPerHost,
+		idle:                make(map[string][]*conn),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// NewRequest builds a request for an absolute http or https URL
+func NewRequest(method, rawURL string, body io.Reader) (*request.Request, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("unsupported url: %s", rawURL)
+	}
+
+	h := headers.NewHeaders()
+	h.Set("Host", u.Host)
+	return &request.Request{
+		RequestLine: &request.RequestLine{Method: method, RequestTarget: u.String(), HttpVersion: "1.1"},
+		Headers:     h,
+		BodyReader:  body,
+	}, nil
+}
+
+// Do sends req and returns the response once its headers have arrived
+func (c *Client) Do(req *request.Request) (*response.Response, error) {
+	return c.DoContext(context.Background(), req)
+}
+
+// DoContext sends req and returns the response once its headers have arrived. The request
+// target is either an absolute URL or a path with the Host header naming the server. The
+// caller reads and closes the response Body, which hands the connection back to the pool.
+// Cancelling ctx aborts the exchange, including reading the body.
+func (c *Client) DoContext(ctx context.Context, req *request.Request) (*response.Response, error) {
+	t, err := parseTarget(req)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		cn, err := c.getConn(ctx, t)
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := c.roundTrip(ctx, cn, req, t)
+		if err == nil {
+			return res, nil
+		}
+		cn.Close()
+
+		// a pooled connection may have been closed by the server while it sat idle; try
+		// again on a new one if nothing of the request was lost and sending it twice is
+		// harmless (RFC 9110 9.2.2)
+		if !cn.reused || req.BodyReader != nil || !isIdempotent(req.RequestLine.Method) || ctx.Err() != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, err
+		}
+	}
+}
+
+// CloseIdleConnections closes the connections kept for reuse
+func (c *Client) CloseIdleConnections() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, conns := range c.idle {
+		for _, cn := range conns {
+			cn.Close()
+		}
+		delete(c.idle, key)
+	}
+}
+
+func (c *Client) roundTrip(ctx context.Context, cn *conn, req *request.Request, t *target) (*response.Response, error) {
+	// cancelling ctx unblocks any read or write in progress on the connection
+	stop := context.AfterFunc(ctx, func() {
+		cn.SetDeadline(time.Unix(1, 0))
+	})
+
+	if err := outgoing(req, t).Write(cn.bw); err != nil {
+		stop()
+		return nil, err
+	}
+
+	if c.responseHeaderTimeout > 0 {
+		cn.SetReadDeadline(time.Now().Add(c.responseHeaderTimeout))
+	}
+	res, err := response.ResponseFromReader(cn.br, req.RequestLine.Method)
+	if err != nil {
+		stop()
+		return nil, err
+	}
+	if c.responseHeaderTimeout > 0 {
+		cn.SetReadDeadline(time.Time{})
+		if ctx.Err() != nil {
+			// cancelled while the deadline above was being cleared
+			stop()
+			return nil, ctx.Err()
+		}
+	}
+
+	res.Body = &body{
+		ReadCloser: res.Body,
+		client:     c,
+		conn:       cn,
+		keepAlive:  c.maxIdleConnsPerHost > 0 && keepAlive(req, res),
+		stop:       stop,
+	}
+	return res, nil
+}
+
+// keepAlive reports whether the connection can carry another request after res has been
+// read to the end
+func keepAlive(req *request.Request, res *response.Response) bool {
+	if hasToken(req.Headers.Get("Connection"), "close") || hasToken(res.Headers.Get("Connection"), "close") {
+		return false
+	}
+	if res.StatusLine.HttpVersion == "1.0" && !hasToken(res.Headers.Get("Connection"), "keep-alive") {
+		return false
+	}
+	if res.StatusLine.StatusCode == response.StatusSwitchingProtocols {
+		return false
+	}
+
+	// a body running until the connection closes leaves nothing to reuse
+	noBody := req.RequestLine.Method == "HEAD" || res.StatusLine.StatusCode == response.StatusNoContent ||
+		res.StatusLine.StatusCode == response.StatusNotModified || res.StatusLine.StatusCode.IsInformational()
+	te := res.Headers.Get("Transfer-Encoding")
+	if te != "" {
+		return noBody || hasToken(te, "chunked")
+	}
+	return noBody || res.Headers.Get("Content-Length") != ""
+}
+
+// body hands the connection back to the pool once the response has been read to the end
+type body struct {
+	io.ReadCloser
+	client    *Client
+	conn      *conn
+	keepAlive bool
+	stop      func() bool
+
+	mu   sync.Mutex
+	done bool
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if errors.Is(err, io.EOF) {
+		b.finish(b.keepAlive)
+	} else if err != nil {
+		b.finish(false)
+	}
+	return n, err
+}
+
+// Close releases the connection. A body not read to the end leaves the connection in an
+// unknown state, so it is closed rather than reused.
+func (b *body) Close() error {
+	b.finish(false)
+	return nil
+}
+
+func (b *body) finish(reuse bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.done {
+		return
+	}
+	b.done = true
+
+	// the deadline set by a cancelled context would break the next request
+	if !b.stop() {
+		reuse = false
+	}
+	if reuse {
+		b.client.putConn(b.conn)
+	} else {
+		b.conn.Close()
+	}
+}
+
+type conn struct {
+	net.Conn
+	key       string
+	br        *bufio.Reader
+	bw        *bufio.Writer
+	reused    bool
+	idleSince time.Time
+}
+
+func (c *Client) getConn(ctx context.Context, t *target) (*conn, error) {
+	if cn := c.idleConn(t.key); cn != nil {
+		return cn, nil
+	}
+
+	dial := c.dial
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: c.dialTimeout}).DialContext
+	}
+	nc, err := dial(ctx, "tcp", t.addr)
+	if err != nil {
+		return nil, err
+	}
+	if t.scheme == "https" {
+		cfg := &tls.Config{}
+		if c.tlsConfig != nil {
+			cfg = c.tlsConfig.Clone()
+		}
+		if cfg.ServerName == "" {
+			cfg.ServerName, _, _ = net.SplitHostPort(t.addr)
+		}
+		tc := tls.Client(nc, cfg)
+		hctx, cancel := context.WithTimeout(ctx, c.dialTimeout)
+		defer cancel()
+		if err := tc.HandshakeContext(hctx); err != nil {
+			nc.Close()
+			return nil, err
+		}
+		nc = tc
+	}
+
+	return &conn{
+		Conn: nc,
+		key:  t.key,
+		br:   bufio.NewReaderSize(nc, bufferSize),
+		bw:   bufio.NewWriterSize(nc, bufferSize),
+	}, nil
+}
+
+// idleConn takes the most recently used connection for key from the pool, closing any that
+// have been idle for too long
+func (c *Client) idleConn(key string) *conn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	conns := c.idle[key]
+	defer func() {
+		if len(conns) == 0 {
+			delete(c.idle, key)
+		} else {
+			c.idle[key] = conns
+		}
+	}()
+
+	for len(conns) > 0 {
+		cn := conns[len(conns)-1]
+		conns = conns[:len(conns)-1]
+		if time.Since(cn.idleSince) > c.idleTimeout {
+			cn.Close()
+			continue
+		}
+		cn.reused = true
+		return cn
+	}
+	return nil
+}
+
+func (c *Client) putConn(cn *conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.idle[cn.key]) >= c.maxIdleConnsPerHost {
+		cn.Close()
+		return
+	}
+	cn.idleSince = time.Now()
+	c.idle[cn.key] = append(c.idle[cn.key], cn)
+}
+
+// target is where a request goes and what it asks for there
+type target struct {
+	scheme string
+	host   string // for the Host header
+	addr   string // host:port to dial
+	path   string // origin-form request target
+	key    string
+}
+
+func parseTarget(req *request.Request) (*target, error) {
+	t := &target{scheme: "http", path: req.RequestLine.RequestTarget, host: req.Headers.Get("Host")}
+
+	if !strings.HasPrefix(t.path, "/") && t.path != "*" {
+		u, err := url.Parse(t.path)
+		if err != nil {
+			return nil, err
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("unsupported request target: %s", t.path)
+		}
+		t.scheme = u.Scheme
+		t.host = u.Host
+		t.path = u.RequestURI()
+	}
+	if t.host == "" {
+		return nil, fmt.Errorf("request has no host")
+	}
+
+	t.addr = t.host
+	if _, _, err := net.SplitHostPort(t.host); err != nil {
+		port := "80"
+		if t.scheme == "https" {
+			port = "443"
+		}
+		t.addr = net.JoinHostPort(strings.Trim(t.host, "[]"), port)
+	}
+	t.key = t.scheme + "://" + t.addr
+	return t, nil
+}
+
+// outgoing returns req as it goes to the server: origin-form target with the Host field
+// first, as RFC 9112 3.2 recommends
+func outgoing(req *request.Request, t *target) *request.Request {
+	h := headers.NewHeaders()
+	h.Set("Host", t.host)
+	for name, value := range req.Headers.Fields() {
+		if !strings.EqualFold(name, "Host") {
+			h.Set(name, value)
+		}
+	}
+
+	out := *req
+	out.RequestLine = &request.RequestLine{Method: req.RequestLine.Method, RequestTarget: t.path, HttpVersion: "1.1"}
+	out.Headers = h
+	return &out
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "TRACE", "PUT", "DELETE":
+		return true
+	}
+	return false
+}
+
+func hasToken(value, token string) bool {
+	for t := range strings.SplitSeq(value, ",") {
+		if strings.EqualFold(strings.TrimSpace(t), token) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,211 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testServer answers every connection with serve, and counts the connections. net/http
+// parses the requests, so the client is checked against an independent implementation.
+type testServer struct {
+	listener net.Listener
+	conns    atomic.Int32
+}
+
+func newTestServer(t *testing.T, serve func(conn net.Conn, br *bufio.Reader)) *testServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &testServer{listener: l}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			s.conns.Add(1)
+			go func() {
+				defer conn.Close()
+				serve(conn, bufio.NewReader(conn))
+			}()
+		}
+	}()
+	return s
+}
+
+func (s *testServer) url(path string) string {
+	return "http://" + s.listener.Addr().String() + path
+}
+
+// echo answers each request on the connection with its method, target and body
+func echo(conn net.Conn, br *bufio.Reader) {
+	for {
+		req, err := http.ReadRequest(br)
+		if err != nil {
+			return
+		}
+		body, _ := io.ReadAll(req.Body)
+		msg := req.Method + " " + req.RequestURI + " " + strings.Join(req.TransferEncoding, ",") + " " + string(body)
+		io.WriteString(conn, "HTTP/1.1 200 OK\r\nContent-Length: "+strconv.Itoa(len(msg))+"\r\n\r\n"+msg)
+	}
+}
+
+func readBody(t *testing.T, c *Client, method, url string, body io.Reader) string {
+	req, err := NewRequest(method, url, body)
+	require.NoError(t, err)
+	res, err := c.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func TestClient(t *testing.T) {
+	s := newTestServer(t, echo)
+	c := New()
+	defer c.CloseIdleConnections()
+
+	// Test: Requests reuse the kept-alive connection
+	assert.Equal(t, "GET /a?x=1  ", readBody(t, c, "GET", s.url("/a?x=1"), nil))
+	assert.Equal(t, "GET /b  ", readBody(t, c, "GET", s.url("/b"), nil))
+	assert.Equal(t, int32(1), s.conns.Load())
+
+	// Test: Streamed request body is chunked
+	assert.Equal(t, "POST /upload chunked streamed", readBody(t, c, "POST", s.url("/upload"), strings.NewReader("streamed")))
+
+	// Test: Body bytes with a Content-Length
+	req, err := NewRequest("PUT", s.url("/put"), nil)
+	require.NoError(t, err)
+	req.Body = []byte("fixed")
+	res, err := c.Do(req)
+	require.NoError(t, err)
+	b, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "PUT /put  fixed", string(b))
+	assert.Equal(t, int32(1), s.conns.Load())
+
+	// Test: Closing a body early gives up the connection
+	req, err = NewRequest("GET", s.url("/c"), nil)
+	require.NoError(t, err)
+	res, err = c.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, res.Body.Close())
+	assert.Equal(t, "GET /d  ", readBody(t, c, "GET", s.url("/d"), nil))
+	assert.Equal(t, int32(2), s.conns.Load())
+
+	// Test: Origin-form target with a Host header
+	req, err = NewRequest("GET", s.url("/"), nil)
+	require.NoError(t, err)
+	req.RequestLine.RequestTarget = "/origin"
+	res, err = c.Do(req)
+	require.NoError(t, err)
+	b, err = io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "GET /origin  ", string(b))
+
+	// Test: Unsupported URLs
+	_, err = NewRequest("GET", "ftp://example.com/", nil)
+	require.Error(t, err)
+	req.Headers.Remove("Host")
+	_, err = c.Do(req)
+	require.Error(t, err)
+}
+
+func TestClientResponses(t *testing.T) {
+	// Test: Chunked response with trailers, then Connection: close
+	s := newTestServer(t, func(conn net.Conn, br *bufio.Reader) {
+		http.ReadRequest(br)
+		io.WriteString(conn, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n"+
+			"5\r\nhello\r\n0\r\nX-Sum: 5\r\n\r\n")
+		http.ReadRequest(br)
+		io.WriteString(conn, "HTTP/1.1 200 OK\r\nConnection: close\r\nContent-Length: 3\r\n\r\nbye")
+	})
+	c := New()
+	req, err := NewRequest("GET", s.url("/"), nil)
+	require.NoError(t, err)
+	res, err := c.Do(req)
+	require.NoError(t, err)
+	b, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(b))
+	assert.Equal(t, "5", res.Trailers.Get("X-Sum"))
+
+	assert.Equal(t, "bye", readBody(t, c, "GET", s.url("/"), nil))
+	assert.Empty(t, c.idle)
+
+	// Test: Stale pooled connection is retried on a new one
+	s = newTestServer(t, func(conn net.Conn, br *bufio.Reader) {
+		http.ReadRequest(br)
+		// keep-alive by the headers, but the connection closes right after
+		io.WriteString(conn, "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok")
+	})
+	c = New()
+	assert.Equal(t, "ok", readBody(t, c, "GET", s.url("/"), nil))
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, "ok", readBody(t, c, "GET", s.url("/"), nil))
+	assert.Equal(t, int32(2), s.conns.Load())
+
+	// Test: Non-idempotent request is not sent twice
+	time.Sleep(10 * time.Millisecond)
+	req, err = NewRequest("POST", s.url("/"), nil)
+	require.NoError(t, err)
+	req.BodyReader = nil
+	req.Body = []byte("once")
+	req.Headers.Set("Content-Length", "4")
+	_, err = c.Do(req)
+	require.Error(t, err)
+	assert.Equal(t, int32(2), s.conns.Load())
+}
+
+func TestClientTimeouts(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	s := newTestServer(t, func(conn net.Conn, br *bufio.Reader) {
+		http.ReadRequest(br)
+		io.WriteString(conn, "HTTP/1.1 200 OK\r\nContent-Length: 10\r\n\r\npart")
+		<-block
+	})
+
+	// Test: Response header timeout
+	silent := newTestServer(t, func(conn net.Conn, br *bufio.Reader) {
+		<-block
+	})
+	c := New(WithResponseHeaderTimeout(20 * time.Millisecond))
+	req, err := NewRequest("GET", silent.url("/"), nil)
+	require.NoError(t, err)
+	_, err = c.Do(req)
+	var netErr net.Error
+	require.ErrorAs(t, err, &netErr)
+	assert.True(t, netErr.Timeout())
+
+	// Test: Cancelling the context interrupts reading the body
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err = NewRequest("GET", s.url("/"), nil)
+	require.NoError(t, err)
+	res, err := c.DoContext(ctx, req)
+	require.NoError(t, err)
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(res.Body, buf)
+	require.NoError(t, err)
+	time.AfterFunc(10*time.Millisecond, cancel)
+	_, err = io.ReadAll(res.Body)
+	require.Error(t, err)
+	assert.Empty(t, c.idle)
+
+	// Test: Cancelled before sending
+	_, err = c.DoContext(ctx, req)
+	require.ErrorIs(t, err, context.Canceled)
+}
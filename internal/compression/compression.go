@@ -0,0 +1,201 @@
+package compression
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/Supasiti/prac-go-http-protocol/internal/cachecontrol"
+	"github.com/Supasiti/prac-go-http-protocol/internal/negotiation"
+	"github.com/Supasiti/prac-go-http-protocol/internal/request"
+	"github.com/Supasiti/prac-go-http-protocol/internal/response"
+	"github.com/Supasiti/prac-go-http-protocol/internal/server"
+)
+
+// DefaultMinSize is the smallest body worth compressing when its length is known
+const DefaultMinSize = 1024
+
+// zstdWindowSize is the largest window a zstd encoder uses. HTTP recipients only have to
+// support windows up to 8MB (RFC 9659 3).
+const zstdWindowSize = 8 << 20
+
+const (
+	EncodingZstd     = "zstd"
+	EncodingGzip     = "gzip"
+	EncodingDeflate  = "deflate"
+	EncodingIdentity = "identity"
+)
+
+// offers lists the codings supported by default, in order of preference
+var offers = []string{EncodingGzip, EncodingDeflate, EncodingIdentity}
+
+// incompressible lists media types that are compressed already
+var incompressible = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"font/woff",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/zstd",
+	"application/x-7z-compressed",
+	"application/x-rar-compressed",
+	"application/pdf",
+	"application/octet-stream",
+}
+
+type config struct {
+	minSize int
+	level   int
+	offers  []string
+}
+
+type Option func(*config)
+
+// WithMinSize changes the smallest Content-Length that gets compressed
+func WithMinSize(n int) Option {
+	return func(c *config) {
+		c.minSize = n
+	}
+}
+
+// WithZstd offers zstd (RFC 8878) ahead of the other codings, to clients that accept it
+func WithZstd() Option {
+	return func(c *config) {
+		c.offers = append([]string{EncodingZstd}, offers...)
+	}
+}
+
+// WithLevel sets the compression level, see compress/flate for the accepted range
+func WithLevel(level int) Option {
+	return func(c *config) {
+		c.level = level
+	}
+}
+
+// Middleware compresses response bodies with the best coding the client accepts. The
+// response is switched to chunked transfer coding, so handlers can keep using either
+// WriteBody or the chunk and trailer API. Compressed responses no longer advertise
+// Accept-Ranges, as partial responses are left unencoded, and their ETag is made weak.
+func Middleware(next server.Handler, opts ...Option) server.Handler {
+	cfg := &config{minSize: DefaultMinSize, level: flate.DefaultCompression, offers: offers}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	return func(w *response.Writer, req *request.Request) {
+		encoding, err := negotiation.Encoding(req, cfg.offers...)
+		if err != nil {
+			encoding = EncodingIdentity
+		}
+
+		w.BeforeWriteHeaders(func(w *response.Writer) {
+			negotiation.Vary(w.Header(), negotiation.HeaderAcceptEncoding)
+			if encoding == EncodingIdentity || !compressible(w, cfg) {
+				return
+			}
+
+			w.Header().Set("Content-Encoding", encoding)
+			// ranges are served from the unencoded representation, so byte offsets into this
+			// one would not match them
+			w.Header().Remove("Accept-Ranges")
+			// the encoded bytes differ from the unencoded ones, so a strong tag of the
+			// handler's no longer holds; weak comparison still matches it for 304s
+			if etag := w.Header().Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+				w.Header().Set("ETag", "W/"+etag)
+			}
+			w.SetBodyEncoder(func(dst io.Writer) io.WriteCloser {
+				return newEncoder(encoding, dst, cfg.level)
+			})
+		})
+
+		next(w, req)
+	}
+}
+
+func compressible(w *response.Writer, cfg *config) bool {
+	status := w.Status()
+	if status.IsInformational() || status == response.StatusNoContent ||
+		status == response.StatusNotModified || status == response.StatusPartialContent {
+		return false
+	}
+
+	h := w.Header()
+	if h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" {
+		return false
+	}
+	if cachecontrol.Parse(h).NoTransform {
+		return false
+	}
+
+	if incompressibleType(h.Get("Content-Type")) {
+		return false
+	}
+
+	if raw := h.Get("Content-Length"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err == nil && n < cfg.minSize {
+			return false
+		}
+	}
+	return true
+}
+
+func incompressibleType(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	if strings.HasPrefix(contentType, "image/svg+xml") {
+		return false
+	}
+	for _, prefix := range incompressible {
+		if strings.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func newEncoder(encoding string, dst io.Writer, level int) io.WriteCloser {
+	switch encoding {
+	case EncodingZstd:
+		zw, err := zstd.NewWriter(dst, zstd.WithEncoderLevel(zstdLevel(level)),
+			zstd.WithWindowSize(zstdWindowSize), zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			zw, _ = zstd.NewWriter(dst)
+		}
+		return zw
+	case EncodingDeflate:
+		// "deflate" in HTTP is the zlib format (RFC 9110 8.4.1.2)
+		zw, err := zlib.NewWriterLevel(dst, level)
+		if err != nil {
+			zw = zlib.NewWriter(dst)
+		}
+		return zw
+	default:
+		gw, err := gzip.NewWriterLevel(dst, level)
+		if err != nil {
+			gw = gzip.NewWriter(dst)
+		}
+		return gw
+	}
+}
+
+// zstdLevel maps a compress/flate level onto the nearest zstd speed
+func zstdLevel(level int) zstd.EncoderLevel {
+	switch {
+	case level == flate.DefaultCompression:
+		return zstd.SpeedDefault
+	case level <= flate.BestSpeed:
+		return zstd.SpeedFastest
+	case level >= flate.BestCompression:
+		return zstd.SpeedBestCompression
+	case level >= 7:
+		return zstd.SpeedBetterCompression
+	}
+	return zstd.SpeedDefault
+}
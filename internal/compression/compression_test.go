@@ -0,0 +1,186 @@
+package compression
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Supasiti/prac-go-http-protocol/internal/headers"
+	"github.com/Supasiti/prac-go-http-protocol/internal/request"
+	"github.com/Supasiti/prac-go-http-protocol/internal/response"
+)
+
+var largeBody = []byte(strings.Repeat("all work and no play makes jack a dull boy\n", 100))
+
+func newRequest(acceptEncoding string) *request.Request {
+	h := headers.NewHeaders()
+	if acceptEncoding != "" {
+		h.Set("Accept-Encoding", acceptEncoding)
+	}
+	return &request.Request{
+		RequestLine: &request.RequestLine{Method: "GET", RequestTarget: "/", HttpVersion: "1.1"},
+		Headers:     h,
+	}
+}
+
+// serve runs the handler through the middleware and splits the raw response into its
+// head and dechunked body
+func serve(t *testing.T, req *request.Request, handler func(w *response.Writer), opts ...Option) (string, []byte) {
+	buf := &bytes.Buffer{}
+	w := response.NewWriter(buf)
+	opts = append([]Option{WithMinSize(64)}, opts...)
+	Middleware(func(w *response.Writer, _ *request.Request) { handler(w) }, opts...)(w, req)
+	require.NoError(t, w.Close())
+
+	head, body, ok := strings.Cut(buf.String(), "\r\n\r\n")
+	require.True(t, ok)
+	if !strings.Contains(head, "Transfer-Encoding: chunked") {
+		return head, []byte(body)
+	}
+
+	decoded := &bytes.Buffer{}
+	r := bufio.NewReader(strings.NewReader(body))
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		size, err := strconv.ParseInt(strings.TrimSpace(line), 16, 64)
+		require.NoError(t, err)
+		if size == 0 {
+			break
+		}
+		_, err = io.CopyN(decoded, r, size)
+		require.NoError(t, err)
+		_, err = r.Discard(2)
+		require.NoError(t, err)
+	}
+	return head, decoded.Bytes()
+}
+
+func TestMiddleware(t *testing.T) {
+	writeBody := func(contentType string, body []byte) func(w *response.Writer) {
+		return func(w *response.Writer) {
+			h := response.GetDefaultHeaders(len(body))
+			h.Set("Content-Type", contentType)
+			w.WriteStatusLine(response.StatusOk)
+			w.WriteHeaders(h)
+			w.WriteBody(body)
+		}
+	}
+
+	// Test: Gzip with WriteBody
+	head, body := serve(t, newRequest("gzip, deflate"), writeBody("text/html", largeBody))
+	assert.Contains(t, head, "Content-Encoding: gzip")
+	assert.Contains(t, head, "Vary: Accept-Encoding")
+	assert.NotContains(t, head, "Content-Length")
+	gr, err := gzip.NewReader(bytes.NewReader(body))
+	require.NoError(t, err)
+	plain, err := io.ReadAll(gr)
+	require.NoError(t, err)
+	assert.Equal(t, largeBody, plain)
+
+	// Test: Deflate uses the zlib format
+	head, body = serve(t, newRequest("deflate"), writeBody("application/json", largeBody))
+	assert.Contains(t, head, "Content-Encoding: deflate")
+	zr, err := zlib.NewReader(bytes.NewReader(body))
+	require.NoError(t, err)
+	plain, err = io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, largeBody, plain)
+
+	// Test: Byte ranges are not advertised for the encoded body
+	withRanges := func(w *response.Writer) {
+		w.Header().Set("Accept-Ranges", "bytes")
+		writeBody("text/html", largeBody)(w)
+	}
+	head, _ = serve(t, newRequest("gzip"), withRanges)
+	assert.Contains(t, head, "Content-Encoding: gzip")
+	assert.NotContains(t, head, "Accept-Ranges")
+	head, _ = serve(t, newRequest(""), withRanges)
+	assert.Contains(t, head, "Accept-Ranges: bytes")
+
+	// Test: Strong ETag is weakened for the encoded body only
+	tagged := func(etag string) func(w *response.Writer) {
+		return func(w *response.Writer) {
+			w.Header().Set("ETag", etag)
+			writeBody("text/html", largeBody)(w)
+		}
+	}
+	head, _ = serve(t, newRequest("gzip"), tagged(`"abc"`))
+	assert.Contains(t, head, `Etag: W/"abc"`)
+	head, _ = serve(t, newRequest(""), tagged(`"abc"`))
+	assert.Contains(t, head, `Etag: "abc"`)
+	head, _ = serve(t, newRequest("deflate"), tagged(`W/"abc"`))
+	assert.Contains(t, head, `Etag: W/"abc"`)
+	assert.NotContains(t, head, `W/W/`)
+
+	// Test: zstd is preferred once enabled, and only then
+	head, body = serve(t, newRequest("gzip, zstd"), writeBody("text/html", largeBody), WithZstd())
+	assert.Contains(t, head, "Content-Encoding: zstd")
+	zd, err := zstd.NewReader(bytes.NewReader(body))
+	require.NoError(t, err)
+	plain, err = io.ReadAll(zd)
+	require.NoError(t, err)
+	zd.Close()
+	assert.Equal(t, largeBody, plain)
+	head, _ = serve(t, newRequest("zstd"), writeBody("text/html", largeBody))
+	assert.NotContains(t, head, "Content-Encoding")
+
+	// Test: No Accept-Encoding leaves the body alone but still varies
+	head, body = serve(t, newRequest(""), writeBody("text/html", largeBody))
+	assert.NotContains(t, head, "Content-Encoding")
+	assert.Contains(t, head, "Vary: Accept-Encoding")
+	assert.Contains(t, head, "Content-Length: "+strconv.Itoa(len(largeBody)))
+	assert.Equal(t, largeBody, body)
+
+	// Test: Tiny bodies are not compressed
+	head, body = serve(t, newRequest("gzip"), writeBody("text/plain", []byte("tiny")))
+	assert.NotContains(t, head, "Content-Encoding")
+	assert.Equal(t, "tiny", string(body))
+
+	// Test: Compressed media types are skipped
+	head, _ = serve(t, newRequest("gzip"), writeBody("video/mp4", largeBody))
+	assert.NotContains(t, head, "Content-Encoding")
+
+	// Test: Chunked body with trailers
+	head, body = serve(t, newRequest("gzip"), func(w *response.Writer) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Transfer-Encoding", "chunked")
+		w.Header().Set("Trailer", "X-Done")
+		w.WriteHeader(response.StatusOk)
+		w.WriteChunkBody(largeBody[:100])
+		w.WriteChunkBody(largeBody[100:])
+		w.WriteChunkBodyDone()
+		trailers := headers.NewHeaders()
+		trailers.Set("X-Done", "yes")
+		w.WriteTrailers(trailers)
+	})
+	assert.Contains(t, head, "Content-Encoding: gzip")
+	gr, err = gzip.NewReader(bytes.NewReader(body))
+	require.NoError(t, err)
+	plain, err = io.ReadAll(gr)
+	require.NoError(t, err)
+	assert.Equal(t, largeBody, plain)
+
+	// Test: Auto framed body
+	head, body = serve(t, newRequest("gzip"), func(w *response.Writer) {
+		w.Header().Set("Content-Type", "text/plain")
+		b := w.Body()
+		b.Write(largeBody)
+		b.Close()
+	})
+	assert.Contains(t, head, "Content-Encoding: gzip")
+	gr, err = gzip.NewReader(bytes.NewReader(body))
+	require.NoError(t, err)
+	plain, err = io.ReadAll(gr)
+	require.NoError(t, err)
+	assert.Equal(t, largeBody, plain)
+}
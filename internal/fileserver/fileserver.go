@@ -0,0 +1,262 @@
+package fileserver
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/Supasiti/prac-go-http-protocol/internal/request"
+	"github.com/Supasiti/prac-go-http-protocol/internal/response"
+	"github.com/Supasiti/prac-go-http-protocol/internal/server"
+)
+
+const DefaultIndex = "index.html"
+
+// sniffLen is as much of a file as http.DetectContentType looks at
+const sniffLen = 512
+
+type config struct {
+	prefix  string
+	index   string
+	listing bool
+}
+
+type Option func(*config)
+
+// WithPrefix strips prefix from the request path before it is looked up, for a handler
+// mounted below the root, e.g. /assets/
+func WithPrefix(prefix string) Option {
+	return func(c *config) {
+		c.prefix = strings.TrimSuffix(prefix, "/")
+	}
+}
+
+// WithIndex changes the file served for a directory. An empty name disables index files.
+func WithIndex(name string) Option {
+	return func(c *config) {
+		c.index = name
+	}
+}
+
+// WithDirectoryListing lists the contents of directories without an index file instead of
+// answering 404
+func WithDirectoryListing() Option {
+	return func(c *config) {
+		c.listing = true
+	}
+}
+
+// Dir opens the directory at dir as the root of a file server. Lookups cannot leave it,
+// whether through .. or through a symlink pointing outside.
+func Dir(dir string) (fs.FS, error) {
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+	return root.FS(), nil
+}
+
+// New returns a handler serving the files in fsys for GET and HEAD requests
+func New(fsys fs.FS, opts ...Option) server.Handler {
+	cfg := &config{index: DefaultIndex}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	return func(w *response.Writer, req *request.Request) {
+		method := req.RequestLine.Method
+		if method != "GET" && method != "HEAD" {
+			w.Header().Set("Allow", "GET, HEAD")
+			writeError(w, response.StatusMethodNotAllowed)
+			return
+		}
+
+		urlPath, name, ok := cfg.resolve(req.RequestLine.RequestTarget)
+		if !ok {
+			writeError(w, response.StatusNotFound)
+			return
+		}
+		serve(w, req, fsys, cfg, urlPath, name)
+	}
+}
+
+// resolve maps a request target to the cleaned URL path and the name to open in the file
+// system. Cleaning an absolute path removes every .. element, so the name stays inside.
+func (c *config) resolve(target string) (string, string, bool) {
+	target, _, _ = strings.Cut(target, "?")
+	p, err := url.PathUnescape(target)
+	if err != nil || strings.ContainsAny(p, "\x00\\") {
+		return "", "", false
+	}
+
+	cleaned := path.Clean("/" + p)
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	if c.prefix != "" {
+		rest, found := strings.CutPrefix(cleaned, c.prefix)
+		if !found || (rest != "" && !strings.HasPrefix(rest, "/")) {
+			return "", "", false
+		}
+		cleaned = "/" + strings.TrimPrefix(rest, "/")
+	}
+
+	name := strings.Trim(cleaned, "/")
+	if name == "" {
+		name = "."
+	}
+	if !fs.ValidPath(name) {
+		return "", "", false
+	}
+	return c.prefix + cleaned, name, true
+}
+
+func serve(w *response.Writer, req *request.Request, fsys fs.FS, cfg *config, urlPath, name string) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		if !errors.Is(err, fs.ErrPermission) {
+			// os.Root refuses symlinks leaving the root with an unexported error; as far as
+			// the client can tell, there is nothing at that path
+			writeError(w, response.StatusNotFound)
+			return
+		}
+		writeFSError(w, err)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		writeFSError(w, err)
+		return
+	}
+
+	if info.IsDir() {
+		// relative links in the page only work below a trailing slash
+		if !strings.HasSuffix(urlPath, "/") {
+			redirect(w, urlPath+"/")
+			return
+		}
+		if cfg.index != "" {
+			index := path.Join(name, cfg.index)
+			if indexInfo, err := fs.Stat(fsys, index); err == nil && !indexInfo.IsDir() {
+				serve(w, req, fsys, cfg, urlPath+cfg.index, index)
+				return
+			}
+		}
+		if !cfg.listing {
+			writeError(w, response.StatusNotFound)
+			return
+		}
+		listDir(w, fsys, name, urlPath)
+		return
+	}
+
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(f)
+		if err != nil {
+			writeFSError(w, err)
+			return
+		}
+		content = bytes.NewReader(data)
+	}
+
+	contentType, err := detectContentType(name, content)
+	if err != nil {
+		writeFSError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("ETag", response.WeakETag(info.Size(), info.ModTime()))
+
+	if err := response.ServeContent(w, req, info.ModTime(), content); err != nil {
+		log.Printf("Error serving %s: %s", name, err)
+	}
+}
+
+// detectContentType looks at the extension first and sniffs the content when it is unknown
+func detectContentType(name string, content io.ReadSeeker) (string, error) {
+	if ctype := mime.TypeByExtension(path.Ext(name)); ctype != "" {
+		return ctype, nil
+	}
+
+	buf := make([]byte, sniffLen)
+	n, err := io.ReadFull(content, buf)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return http.DetectContentType(buf[:n]), nil
+}
+
+func listDir(w *response.Writer, fsys fs.FS, name, urlPath string) {
+	entries, err := fs.ReadDir(fsys, name)
+	if err != nil {
+		writeFSError(w, err)
+		return
+	}
+
+	var b strings.Builder
+	title := html.EscapeString(urlPath)
+	fmt.Fprintf(&b, "<html>\n<head><title>Index of %s</title></head>\n<body>\n<h1>Index of %s</h1>\n<ul>\n", title, title)
+	if urlPath != "/" {
+		b.WriteString("<li><a href=\"../\">../</a></li>\n")
+	}
+	for _, e := range entries {
+		entry := e.Name()
+		if e.IsDir() {
+			entry += "/"
+		}
+		href := (&url.URL{Path: entry}).EscapedPath()
+		if strings.Contains(entry, ":") {
+			// keep a colon in the name from reading as a scheme
+			href = "./" + href
+		}
+		fmt.Fprintf(&b, "<li><a href=\"%s\">%s</a></li>\n", html.EscapeString(href), html.EscapeString(entry))
+	}
+	b.WriteString("</ul>\n</body>\n</html>\n")
+
+	body := []byte(b.String())
+	h := response.GetDefaultHeaders(len(body))
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteStatusLine(response.StatusOk)
+	w.WriteHeaders(h)
+	w.WriteBody(body)
+}
+
+func redirect(w *response.Writer, location string) {
+	w.Header().Set("Location", (&url.URL{Path: location}).EscapedPath())
+	writeError(w, response.StatusMovedPermanently)
+}
+
+func writeFSError(w *response.Writer, err error) {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		writeError(w, response.StatusNotFound)
+	case errors.Is(err, fs.ErrPermission):
+		writeError(w, response.StatusForbidden)
+	default:
+		log.Printf("Error reading file: %s", err)
+		writeError(w, response.StatusInternalServerError)
+	}
+}
+
+func writeError(w *response.Writer, status response.StatusCode) {
+	body := []byte(response.StatusText(status) + "\n")
+	w.WriteStatusLine(status)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+}
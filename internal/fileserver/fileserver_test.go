@@ -0,0 +1,128 @@
+package fileserver
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Supasiti/prac-go-http-protocol/internal/headers"
+	"github.com/Supasiti/prac-go-http-protocol/internal/request"
+	"github.com/Supasiti/prac-go-http-protocol/internal/response"
+	"github.com/Supasiti/prac-go-http-protocol/internal/server"
+)
+
+func get(t *testing.T, handler server.Handler, method, target string) string {
+	buf := &bytes.Buffer{}
+	w := response.NewWriter(buf)
+	w.SetRequestMethod(method)
+	req := &request.Request{
+		RequestLine: &request.RequestLine{Method: method, RequestTarget: target, HttpVersion: "1.1"},
+		Headers:     headers.NewHeaders(),
+	}
+	handler(w, req)
+	require.NoError(t, w.Close())
+	return buf.String()
+}
+
+func TestFileServer(t *testing.T) {
+	modtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"hello.txt":             {Data: []byte("hello"), ModTime: modtime},
+		"docs/index.html":       {Data: []byte("<p>docs</p>")},
+		"files/a b.css":         {Data: []byte("body{}")},
+		"files/sub/noextension": {Data: []byte("<!DOCTYPE html><p>sniffed</p>")},
+	}
+	handler := New(fsys, WithDirectoryListing())
+
+	// Test: File with type from the extension and Last-Modified
+	out := get(t, handler, "GET", "/hello.txt")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, out, "Content-Type: text/plain; charset=utf-8\r\n")
+	assert.Contains(t, out, "Last-Modified: Tue, 02 Jan 2024 03:04:05 GMT\r\n")
+	assert.Contains(t, out, "Etag: W/\"")
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\nhello"))
+
+	// Test: Sniffed content type
+	out = get(t, handler, "GET", "/files/sub/noextension")
+	assert.Contains(t, out, "Content-Type: text/html; charset=utf-8\r\n")
+
+	// Test: Escaped names and query strings
+	out = get(t, handler, "GET", "/files/a%20b.css?v=2")
+	assert.Contains(t, out, "Content-Type: text/css; charset=utf-8\r\n")
+
+	// Test: Index file
+	out = get(t, handler, "GET", "/docs/")
+	assert.True(t, strings.HasSuffix(out, "<p>docs</p>"))
+
+	// Test: Directory without a trailing slash is redirected
+	out = get(t, handler, "GET", "/docs")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 301 Moved Permanently\r\n"))
+	assert.Contains(t, out, "Location: /docs/\r\n")
+
+	// Test: Directory listing
+	out = get(t, handler, "GET", "/files/")
+	assert.Contains(t, out, `<a href="a%20b.css">a b.css</a>`)
+	assert.Contains(t, out, `<a href="sub/">sub/</a>`)
+
+	// Test: No listing unless enabled
+	out = get(t, New(fsys), "GET", "/files/")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 404 Not Found\r\n"))
+
+	// Test: Missing file and other methods
+	out = get(t, handler, "GET", "/missing.txt")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 404 Not Found\r\n"))
+	out = get(t, handler, "POST", "/hello.txt")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 405 Method Not Allowed\r\n"))
+	assert.Contains(t, out, "Allow: GET, HEAD\r\n")
+
+	// Test: HEAD has the headers without the body
+	out = get(t, handler, "HEAD", "/hello.txt")
+	assert.Contains(t, out, "Content-Length: 5\r\n")
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\n"))
+
+	// Test: Prefix is stripped, other paths are not found
+	prefixed := New(fsys, WithPrefix("/assets/"))
+	out = get(t, prefixed, "GET", "/assets/hello.txt")
+	assert.True(t, strings.HasSuffix(out, "hello"))
+	out = get(t, prefixed, "GET", "/assetshello.txt")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 404 Not Found\r\n"))
+	out = get(t, prefixed, "GET", "/assets/docs")
+	assert.Contains(t, out, "Location: /assets/docs/\r\n")
+}
+
+func TestFileServerTraversal(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	require.NoError(t, os.Mkdir(root, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "secret.txt"), []byte("secret"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "public.txt"), []byte("public"), 0o644))
+	require.NoError(t, os.Symlink(filepath.Join(dir, "secret.txt"), filepath.Join(root, "escape.txt")))
+	require.NoError(t, os.Symlink("public.txt", filepath.Join(root, "inside.txt")))
+
+	fsys, err := Dir(root)
+	require.NoError(t, err)
+	handler := New(fsys)
+
+	// Test: Files inside the root, including through a symlink that stays inside
+	assert.True(t, strings.HasSuffix(get(t, handler, "GET", "/public.txt"), "public"))
+	assert.True(t, strings.HasSuffix(get(t, handler, "GET", "/inside.txt"), "public"))
+
+	// Test: Dot-dot never leaves the root
+	for _, target := range []string{"/../secret.txt", "/%2e%2e/secret.txt", "/a/../../secret.txt", "/..%5csecret.txt"} {
+		out := get(t, handler, "GET", target)
+		assert.NotContains(t, out, "secret\n", target)
+		assert.True(t, strings.HasPrefix(out, "HTTP/1.1 404 Not Found\r\n"), target)
+	}
+
+	// Test: Symlink pointing outside the root
+	out := get(t, handler, "GET", "/escape.txt")
+	assert.False(t, strings.HasSuffix(out, "secret"))
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 404 Not Found\r\n"))
+}
@@ -4,17 +4,24 @@ import (
 	"bytes"
 	"fmt"
 	"iter"
-	"maps"
 	"slices"
 	"strings"
 )
 
+// Headers is a case-insensitive set of fields that remembers the order in which fields
+// were first set and the spelling of their names.
 type Headers struct {
-	data map[string]string
+	data  map[string]string
+	names map[string]string
+	order []string
 }
 
 func NewHeaders() *Headers {
-	return &Headers{data: make(map[string]string)}
+	return &Headers{
+		data:  make(map[string]string),
+		names: make(map[string]string),
+		order: make([]string, 0),
+	}
 }
 
 const CRLF = "\r\n"
@@ -28,8 +35,30 @@ func (h *Headers) Add(key, value string) {
 	}
 }
 
+// All yields the lowercased field names and values in insertion order
 func (h *Headers) All() iter.Seq2[string, string] {
-	return maps.All(h.data)
+	return func(yield func(string, string) bool) {
+		for _, key := range h.order {
+			if !yield(key, h.data[key]) {
+				return
+			}
+		}
+	}
+}
+
+// Fields yields field names spelled as they were first set, and values, in insertion order
+func (h *Headers) Fields() iter.Seq2[string, string] {
+	return func(yield func(string, string) bool) {
+		for _, key := range h.order {
+			if !yield(h.names[key], h.data[key]) {
+				return
+			}
+		}
+	}
+}
+
+func (h *Headers) Len() int {
+	return len(h.order)
 }
 
 func (h *Headers) Get(key string) string {
@@ -41,11 +70,23 @@ func (h *Headers) Get(key string) string {
 }
 
 func (h *Headers) Remove(key string) {
-	delete(h.data, strings.ToLower(key))
+	lower := strings.ToLower(key)
+	if _, ok := h.data[lower]; !ok {
+		return
+	}
+
+	delete(h.data, lower)
+	delete(h.names, lower)
+	h.order = slices.DeleteFunc(h.order, func(k string) bool { return k == lower })
 }
 
 func (h *Headers) Set(key, value string) {
-	h.data[strings.ToLower(key)] = value
+	lower := strings.ToLower(key)
+	if _, ok := h.data[lower]; !ok {
+		h.names[lower] = key
+		h.order = append(h.order, lower)
+	}
+	h.data[lower] = value
 }
 
 func (h *Headers) Parse(data []byte) (n int, done bool, err error) {
@@ -60,10 +101,13 @@ func (h *Headers) Parse(data []byte) (n int, done bool, err error) {
 
 	clean := bytes.TrimSpace(data[:eol]) // Host: localhost:42069
 	sepPos := bytes.Index(clean, []byte(keyValueSep))
+	if sepPos < 0 {
+		return 0, false, fmt.Errorf("Field line missing colon: %s", clean)
+	}
 
 	// Key
-	key := strings.ToLower(string(clean[:sepPos]))
-	if !validKeyTokens(key) {
+	key := string(clean[:sepPos])
+	if !validKeyTokens(strings.ToLower(key)) {
 		return 0, false, fmt.Errorf("Field name coltains invalid character: %s", key)
 	}
 
@@ -74,6 +118,27 @@ func (h *Headers) Parse(data []byte) (n int, done bool, err error) {
 	return eol + 2, false, nil
 }
 
+// CanonicalKey returns the Title-Case form of a field name, e.g. content-length becomes
+// Content-Length. Names with characters outside of a token are returned unchanged.
+func CanonicalKey(key string) string {
+	if !validKeyTokens(strings.ToLower(key)) {
+		return key
+	}
+
+	b := []byte(key)
+	upper := true
+	for i, c := range b {
+		switch {
+		case upper && c >= 'a' && c <= 'z':
+			b[i] = c - ('a' - 'A')
+		case !upper && c >= 'A' && c <= 'Z':
+			b[i] = c + ('a' - 'A')
+		}
+		upper = c == '-'
+	}
+	return string(b)
+}
+
 var tokenChars = []rune{'!', '#', '$', '%', '&', '\'', '*', '+', '-', '.', '^', '_', '`', '|', '~'}
 
 func validKeyTokens(key string) bool {
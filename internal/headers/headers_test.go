@@ -51,6 +51,12 @@ func TestHeadersParse(t *testing.T) {
 	assert.Equal(t, "text/html, application/xhtml+xml", headers.Get("Accept"))
 	assert.False(t, done)
 
+	// Test: Invalid field line without a colon
+	headers = NewHeaders()
+	data = []byte("Host localhost\r\n\r\n")
+	_, _, err = headers.Parse(data)
+	require.Error(t, err)
+
 	// Test: Valid done
 	headers = NewHeaders()
 	data = []byte("\r\n")
@@ -86,4 +92,55 @@ func TestHeadersParse(t *testing.T) {
 	assert.Equal(t, 0, n)
 	assert.False(t, done)
 
+	// Test: Field names keep their spelling
+	headers = NewHeaders()
+	data = []byte("X-Request-ID: abc\r\n\r\n")
+	_, _, err = headers.Parse(data)
+	require.NoError(t, err)
+	for name, value := range headers.Fields() {
+		assert.Equal(t, "X-Request-ID", name)
+		assert.Equal(t, "abc", value)
+	}
+}
+
+func TestHeadersOrder(t *testing.T) {
+	// Test: Insertion order is kept
+	headers := NewHeaders()
+	headers.Set("Content-Type", "text/plain")
+	headers.Set("content-length", "10")
+	headers.Set("Connection", "close")
+	headers.Set("CONTENT-TYPE", "text/html")
+
+	keys := make([]string, 0)
+	values := make([]string, 0)
+	for key, value := range headers.All() {
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+	assert.Equal(t, []string{"content-type", "content-length", "connection"}, keys)
+	assert.Equal(t, []string{"text/html", "10", "close"}, values)
+
+	names := make([]string, 0)
+	for name := range headers.Fields() {
+		names = append(names, name)
+	}
+	assert.Equal(t, []string{"Content-Type", "content-length", "Connection"}, names)
+
+	// Test: Removed fields go to the back when set again
+	headers.Remove("content-type")
+	headers.Set("Content-Type", "application/json")
+	keys = keys[:0]
+	for key := range headers.All() {
+		keys = append(keys, key)
+	}
+	assert.Equal(t, []string{"content-length", "connection", "content-type"}, keys)
+	assert.Equal(t, 3, headers.Len())
+}
+
+func TestCanonicalKey(t *testing.T) {
+	assert.Equal(t, "Content-Length", CanonicalKey("content-length"))
+	assert.Equal(t, "X-Content-Sha256", CanonicalKey("X-CONTENT-SHA256"))
+	assert.Equal(t, "Etag", CanonicalKey("ETag"))
+	assert.Equal(t, "Host", CanonicalKey("host"))
+	assert.Equal(t, "bad key", CanonicalKey("bad key"))
 }
@@ -0,0 +1,29 @@
+package headers
+
+import "time"
+
+// TimeFormat is the IMF-fixdate layout used by Date, Last-Modified and friends
+const TimeFormat = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+// obsolete formats recipients must still accept (RFC 9110 5.6.7)
+var timeFormats = []string{
+	TimeFormat,
+	"Monday, 02-Jan-06 15:04:05 GMT", // RFC 850
+	time.ANSIC,
+}
+
+func FormatTime(t time.Time) string {
+	return t.UTC().Format(TimeFormat)
+}
+
+// ParseTime parses an HTTP-date in any of the formats allowed by RFC 9110
+func ParseTime(s string) (time.Time, error) {
+	var err error
+	for _, layout := range timeFormats {
+		var t time.Time
+		if t, err = time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
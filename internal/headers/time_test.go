@@ -0,0 +1,33 @@
+package headers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTime(t *testing.T) {
+	want := time.Date(1994, time.November, 6, 8, 49, 37, 0, time.UTC)
+
+	// Test: IMF-fixdate and the obsolete formats
+	for _, s := range []string{
+		"Sun, 06 Nov 1994 08:49:37 GMT",
+		"Sunday, 06-Nov-94 08:49:37 GMT",
+		"Sun Nov  6 08:49:37 1994",
+	} {
+		got, err := ParseTime(s)
+		require.NoError(t, err, s)
+		assert.True(t, want.Equal(got), s)
+	}
+
+	// Test: Round trip
+	got, err := ParseTime(FormatTime(want))
+	require.NoError(t, err)
+	assert.True(t, want.Equal(got))
+
+	// Test: Not a date
+	_, err = ParseTime("yesterday")
+	require.Error(t, err)
+}
@@ -0,0 +1,91 @@
+package negotiation
+
+import (
+	"strconv"
+	"strings"
+)
+
+// acceptRange is a single element of an Accept-* header, e.g. `text/html;level=1;q=0.7`
+type acceptRange struct {
+	value  string
+	params map[string]string
+	q      float64
+}
+
+// parseAccept splits an Accept-* header value into its ranges. Elements with a malformed
+// weight are dropped as if they were never sent.
+func parseAccept(raw string) []acceptRange {
+	ranges := make([]acceptRange, 0)
+	for _, elem := range splitQuoted(raw, ',') {
+		elem = strings.TrimSpace(elem)
+		if elem == "" {
+			continue
+		}
+
+		parts := splitQuoted(elem, ';')
+		r := acceptRange{
+			value:  strings.ToLower(strings.TrimSpace(parts[0])),
+			params: make(map[string]string),
+			q:      1,
+		}
+
+		valid := true
+		for _, p := range parts[1:] {
+			key, value, _ := strings.Cut(p, "=")
+			key = strings.ToLower(strings.TrimSpace(key))
+			value = strings.Trim(strings.TrimSpace(value), `"`)
+			if key == "q" {
+				q, err := parseQValue(value)
+				if err != nil {
+					valid = false
+					break
+				}
+				r.q = q
+				// accept-ext after the weight are not used for matching
+				break
+			}
+			if key != "" {
+				r.params[key] = value
+			}
+		}
+
+		if valid && r.value != "" {
+			ranges = append(ranges, r)
+		}
+	}
+	return ranges
+}
+
+func parseQValue(s string) (float64, error) {
+	q, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	if q < 0 || q > 1 {
+		return 0, strconv.ErrRange
+	}
+	return q, nil
+}
+
+// splitQuoted splits s on sep, ignoring separators inside quoted strings
+func splitQuoted(s string, sep byte) []string {
+	parts := make([]string, 0)
+	inQuote := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if inQuote {
+				i++
+			}
+		case '"':
+			inQuote = !inQuote
+		case sep:
+			if !inQuote {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
@@ -0,0 +1,181 @@
+package negotiation
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/Supasiti/prac-go-http-protocol/internal/headers"
+	"github.com/Supasiti/prac-go-http-protocol/internal/request"
+)
+
+var ErrNotAcceptable = errors.New("none of the offers are acceptable")
+
+const (
+	HeaderAccept         = "Accept"
+	HeaderAcceptLanguage = "Accept-Language"
+	HeaderAcceptEncoding = "Accept-Encoding"
+
+	identity = "identity"
+)
+
+// matchFunc reports how specifically a range matches an offer; -1 means no match
+type matchFunc func(r acceptRange, offer string) int
+
+// ContentType picks the best media type among offers based on the Accept header. Offers
+// are listed in order of server preference, which breaks ties between equal weights.
+func ContentType(req *request.Request, offers ...string) (string, error) {
+	return negotiate(req.Headers.Get(HeaderAccept), offers, matchMediaType, nil)
+}
+
+// Language picks the best language tag among offers based on the Accept-Language header.
+func Language(req *request.Request, offers ...string) (string, error) {
+	return negotiate(req.Headers.Get(HeaderAcceptLanguage), offers, matchLanguage, nil)
+}
+
+// Encoding picks the best content coding among offers based on the Accept-Encoding header.
+// When the header is missing, identity is preferred if it is offered.
+func Encoding(req *request.Request, offers ...string) (string, error) {
+	raw := req.Headers.Get(HeaderAcceptEncoding)
+	if raw == "" {
+		for _, offer := range offers {
+			if strings.EqualFold(offer, identity) {
+				return offer, nil
+			}
+		}
+	}
+	return negotiate(raw, offers, matchEncoding, identityWeight)
+}
+
+// identityWeight keeps identity acceptable unless a range explicitly excludes it
+func identityWeight(offer string) float64 {
+	if strings.EqualFold(offer, identity) {
+		return 1
+	}
+	return 0
+}
+
+// Vary adds fields to the Vary header, skipping those already listed
+func Vary(h *headers.Headers, fields ...string) {
+	cur := h.Get("Vary")
+	if strings.TrimSpace(cur) == "*" {
+		return
+	}
+
+	listed := make(map[string]bool)
+	for _, f := range strings.Split(cur, ",") {
+		listed[strings.ToLower(strings.TrimSpace(f))] = true
+	}
+
+	for _, f := range fields {
+		key := strings.ToLower(f)
+		if listed[key] {
+			continue
+		}
+		listed[key] = true
+		h.Add("Vary", f)
+	}
+}
+
+func negotiate(raw string, offers []string, match matchFunc, unmatched func(string) float64) (string, error) {
+	if len(offers) == 0 {
+		return "", ErrNotAcceptable
+	}
+	if raw == "" {
+		return offers[0], nil
+	}
+
+	ranges := parseAccept(raw)
+	if len(ranges) == 0 {
+		return offers[0], nil
+	}
+
+	best := ""
+	bestQ := 0.0
+	for _, offer := range offers {
+		q, ok := weight(ranges, offer, match)
+		if !ok && unmatched != nil {
+			q = unmatched(offer)
+		}
+		if q > bestQ {
+			best = offer
+			bestQ = q
+		}
+	}
+
+	if bestQ == 0 {
+		return "", ErrNotAcceptable
+	}
+	return best, nil
+}
+
+// weight returns the q-value of the most specific range matching the offer
+func weight(ranges []acceptRange, offer string, match matchFunc) (float64, bool) {
+	specificity := -1
+	q := 0.0
+	for _, r := range ranges {
+		s := match(r, offer)
+		if s > specificity {
+			specificity = s
+			q = r.q
+		}
+	}
+	return q, specificity >= 0
+}
+
+func matchMediaType(r acceptRange, offer string) int {
+	parsed := parseAccept(offer)
+	if len(parsed) == 0 {
+		return -1
+	}
+	o := parsed[0]
+
+	rType, rSub, ok := strings.Cut(r.value, "/")
+	if !ok {
+		return -1
+	}
+	oType, oSub, ok := strings.Cut(o.value, "/")
+	if !ok {
+		return -1
+	}
+
+	switch {
+	case rType == "*" && rSub == "*":
+		return 0
+	case rType == oType && rSub == "*":
+		return 1
+	case rType == oType && rSub == oSub:
+		for key, value := range r.params {
+			if !strings.EqualFold(o.params[key], value) {
+				return -1
+			}
+		}
+		return 2 + len(r.params)
+	default:
+		return -1
+	}
+}
+
+func matchLanguage(r acceptRange, offer string) int {
+	tag := strings.ToLower(offer)
+	switch {
+	case r.value == "*":
+		return 0
+	case r.value == tag:
+		return len(r.value) + 1
+	case strings.HasPrefix(tag, r.value+"-"):
+		return len(r.value)
+	default:
+		return -1
+	}
+}
+
+func matchEncoding(r acceptRange, offer string) int {
+	switch {
+	case r.value == "*":
+		return 0
+	case r.value == strings.ToLower(offer):
+		return 1
+	default:
+		return -1
+	}
+}
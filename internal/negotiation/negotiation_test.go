@@ -0,0 +1,125 @@
+package negotiation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Supasiti/prac-go-http-protocol/internal/headers"
+	"github.com/Supasiti/prac-go-http-protocol/internal/request"
+)
+
+func newRequestWith(key, value string) *request.Request {
+	h := headers.NewHeaders()
+	if value != "" {
+		h.Set(key, value)
+	}
+	return &request.Request{
+		RequestLine: &request.RequestLine{Method: "GET", RequestTarget: "/", HttpVersion: "1.1"},
+		Headers:     h,
+	}
+}
+
+func TestContentType(t *testing.T) {
+	offers := []string{"text/html", "application/json", "text/plain"}
+
+	// Test: Missing Accept picks the first offer
+	got, err := ContentType(newRequestWith(HeaderAccept, ""), offers...)
+	require.NoError(t, err)
+	assert.Equal(t, "text/html", got)
+
+	// Test: Wildcard picks the first offer
+	got, err = ContentType(newRequestWith(HeaderAccept, "*/*"), offers...)
+	require.NoError(t, err)
+	assert.Equal(t, "text/html", got)
+
+	// Test: Highest q-value wins
+	got, err = ContentType(newRequestWith(HeaderAccept, "text/html;q=0.5, application/json"), offers...)
+	require.NoError(t, err)
+	assert.Equal(t, "application/json", got)
+
+	// Test: More specific range overrides a wildcard
+	got, err = ContentType(newRequestWith(HeaderAccept, "text/*;q=0.9, text/html;q=0.1, */*;q=0.2"), offers...)
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain", got)
+
+	// Test: Excluded type with q=0
+	got, err = ContentType(newRequestWith(HeaderAccept, "text/html;q=0, */*;q=0.1"), offers...)
+	require.NoError(t, err)
+	assert.Equal(t, "application/json", got)
+
+	// Test: Media type parameters must match
+	got, err = ContentType(newRequestWith(HeaderAccept, "text/plain;charset=utf-8, text/plain;q=0.2"), "text/plain;charset=utf-8")
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain;charset=utf-8", got)
+
+	// Test: Nothing matches
+	_, err = ContentType(newRequestWith(HeaderAccept, "image/png"), offers...)
+	require.ErrorIs(t, err, ErrNotAcceptable)
+
+	// Test: Malformed weights are ignored
+	got, err = ContentType(newRequestWith(HeaderAccept, "text/html;q=abc, application/json;q=0.3"), offers...)
+	require.NoError(t, err)
+	assert.Equal(t, "application/json", got)
+}
+
+func TestLanguage(t *testing.T) {
+	offers := []string{"en-US", "fr", "de-CH"}
+
+	// Test: Prefix range matches a longer tag
+	got, err := Language(newRequestWith(HeaderAcceptLanguage, "de, fr;q=0.5"), offers...)
+	require.NoError(t, err)
+	assert.Equal(t, "de-CH", got)
+
+	// Test: Case insensitive tags
+	got, err = Language(newRequestWith(HeaderAcceptLanguage, "EN-us"), offers...)
+	require.NoError(t, err)
+	assert.Equal(t, "en-US", got)
+
+	// Test: Wildcard with exclusion
+	got, err = Language(newRequestWith(HeaderAcceptLanguage, "*, en;q=0"), offers...)
+	require.NoError(t, err)
+	assert.Equal(t, "fr", got)
+
+	// Test: Nothing matches
+	_, err = Language(newRequestWith(HeaderAcceptLanguage, "ja"), offers...)
+	require.ErrorIs(t, err, ErrNotAcceptable)
+}
+
+func TestEncoding(t *testing.T) {
+	offers := []string{"gzip", "deflate", "identity"}
+
+	// Test: Missing header prefers identity
+	got, err := Encoding(newRequestWith(HeaderAcceptEncoding, ""), offers...)
+	require.NoError(t, err)
+	assert.Equal(t, "identity", got)
+
+	// Test: Preferred coding
+	got, err = Encoding(newRequestWith(HeaderAcceptEncoding, "deflate, gzip;q=0.5"), offers...)
+	require.NoError(t, err)
+	assert.Equal(t, "deflate", got)
+
+	// Test: Identity is acceptable when not listed
+	got, err = Encoding(newRequestWith(HeaderAcceptEncoding, "br"), offers...)
+	require.NoError(t, err)
+	assert.Equal(t, "identity", got)
+
+	// Test: Identity excluded by wildcard
+	_, err = Encoding(newRequestWith(HeaderAcceptEncoding, "br, *;q=0"), offers...)
+	require.ErrorIs(t, err, ErrNotAcceptable)
+}
+
+func TestVary(t *testing.T) {
+	// Test: Adds fields once
+	h := headers.NewHeaders()
+	Vary(h, HeaderAccept)
+	Vary(h, "accept", HeaderAcceptEncoding)
+	assert.Equal(t, "Accept, Accept-Encoding", h.Get("Vary"))
+
+	// Test: Vary star is left alone
+	h = headers.NewHeaders()
+	h.Set("Vary", "*")
+	Vary(h, HeaderAccept)
+	assert.Equal(t, "*", h.Get("Vary"))
+}
@@ -0,0 +1,165 @@
+package proxy
+
+import (
+	"cmp"
+	"hash/fnv"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Supasiti/prac-go-http-protocol/internal/request"
+)
+
+// virtualNodes is how many points each upstream has on the consistent hash ring. More
+// points spread the keys more evenly.
+const virtualNodes = 100
+
+// Strategy chooses the upstream for each request. A Strategy keeps state about the
+// upstreams it was given, so each proxy needs its own.
+type Strategy interface {
+	// pick returns the index of the upstream for req, or -1 if none can take it. weights
+	// has an entry per upstream: 0 for one that is down, 1 for one in full service and in
+	// between for one warming up after it recovered.
+	pick(upstreams []*upstream, weights []float64, req *request.Request) int
+}
+
+// RoundRobin takes the upstreams in turn. Those warming up get a share of the turns in
+// proportion to their weight (smooth weighted round-robin).
+func RoundRobin() Strategy {
+	return &roundRobin{}
+}
+
+type roundRobin struct {
+	mu      sync.Mutex
+	current []float64
+}
+
+func (s *roundRobin) pick(_ []*upstream, weights []float64, _ *request.Request) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.current) != len(weights) {
+		s.current = make([]float64, len(weights))
+	}
+
+	best, total := -1, 0.0
+	for i, w := range weights {
+		if w <= 0 {
+			s.current[i] = 0
+			continue
+		}
+		s.current[i] += w
+		total += w
+		if best < 0 || s.current[i] > s.current[best] {
+			best = i
+		}
+	}
+	if best >= 0 {
+		s.current[best] -= total
+	}
+	return best
+}
+
+// LeastConnections sends each request to the upstream with the fewest requests in
+// progress, counting those warming up as busier than they are
+func LeastConnections() Strategy {
+	return &leastConnections{}
+}
+
+type leastConnections struct {
+	// next rotates the starting point so that ties are spread out
+	next atomic.Uint64
+}
+
+func (s *leastConnections) pick(upstreams []*upstream, weights []float64, _ *request.Request) int {
+	start := int(s.next.Add(1) % uint64(len(upstreams)))
+	best, bestScore := -1, 0.0
+	for k := range upstreams {
+		i := (start + k) % len(upstreams)
+		if weights[i] <= 0 {
+			continue
+		}
+		score := float64(upstreams[i].active.Load()+1) / weights[i]
+		if best < 0 || score < bestScore {
+			best, bestScore = i, score
+		}
+	}
+	return best
+}
+
+// ConsistentHash sends requests with the same key to the same upstream. When an upstream
+// goes down only its keys move, and they move back as it warms up again. The key is the
+// value of field, or the client IP when field is empty or missing from the request.
+func ConsistentHash(field string) Strategy {
+	return &consistentHash{field: field}
+}
+
+type consistentHash struct {
+	field string
+
+	once sync.Once
+	ring []ringNode // sorted by hash
+}
+
+type ringNode struct {
+	hash  uint32
+	index int
+}
+
+func (s *consistentHash) pick(upstreams []*upstream, weights []float64, req *request.Request) int {
+	s.once.Do(func() {
+		for i, u := range upstreams {
+			for v := range virtualNodes {
+				s.ring = append(s.ring, ringNode{hash: hash32(u.url.String() + "#" + strconv.Itoa(v)), index: i})
+			}
+		}
+		slices.SortFunc(s.ring, func(a, b ringNode) int {
+			return cmp.Compare(a.hash, b.hash)
+		})
+	})
+
+	key := s.field
+	if key != "" {
+		key = req.Headers.Get(s.field)
+	}
+	if key == "" {
+		key = clientIP(req)
+	}
+	h := hash32(key)
+	// a key goes to an upstream warming up only once its weight has grown past the key's
+	// share, so the same keys come back first and stay
+	share := float64(hash32(key+"#share")%1000) / 1000
+
+	start, _ := slices.BinarySearchFunc(s.ring, h, func(n ringNode, h uint32) int {
+		return cmp.Compare(n.hash, h)
+	})
+	fallback := -1
+	for k := range s.ring {
+		node := s.ring[(start+k)%len(s.ring)]
+		w := weights[node.index]
+		if w <= 0 {
+			continue
+		}
+		if w >= 1 || share < w {
+			return node.index
+		}
+		if fallback < 0 {
+			fallback = node.index
+		}
+	}
+	return fallback
+}
+
+// hash32 is FNV-1a followed by the murmur3 finalizer, as FNV alone spreads keys that
+// differ only in their last characters poorly
+func hash32(s string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	x := h.Sum32()
+	x ^= x >> 16
+	x *= 0x85ebca6b
+	x ^= x >> 13
+	x *= 0xc2b2ae35
+	x ^= x >> 16
+	return x
+}
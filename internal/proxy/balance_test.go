@@ -0,0 +1,132 @@
+package proxy
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Supasiti/prac-go-http-protocol/internal/headers"
+	"github.com/Supasiti/prac-go-http-protocol/internal/request"
+)
+
+func newUpstreams(n int) []*upstream {
+	ups := make([]*upstream, n)
+	for i := range ups {
+		ups[i] = &upstream{url: &url.URL{Scheme: "http", Host: fmt.Sprintf("backend%d:80", i)}}
+	}
+	return ups
+}
+
+func picks(s Strategy, ups []*upstream, weights []float64, n int) []int {
+	req := newProxyRequest("GET", "/", nil)
+	got := make([]int, n)
+	for i := range got {
+		got[i] = s.pick(ups, weights, req)
+	}
+	return got
+}
+
+func TestRoundRobin(t *testing.T) {
+	ups := newUpstreams(3)
+
+	// Test: Upstreams take turns
+	s := RoundRobin()
+	assert.Equal(t, []int{0, 1, 2, 0, 1, 2}, picks(s, ups, []float64{1, 1, 1}, 6))
+
+	// Test: Upstreams that are down are skipped
+	assert.Equal(t, []int{0, 2, 0, 2}, picks(RoundRobin(), ups, []float64{1, 0, 1}, 4))
+
+	// Test: Upstream warming up gets its share of the turns
+	counts := map[int]int{}
+	for _, i := range picks(RoundRobin(), ups, []float64{1, 1, 0.5}, 50) {
+		counts[i]++
+	}
+	assert.Equal(t, map[int]int{0: 20, 1: 20, 2: 10}, counts)
+
+	// Test: None available
+	assert.Equal(t, -1, RoundRobin().pick(ups, []float64{0, 0, 0}, nil))
+}
+
+func TestLeastConnections(t *testing.T) {
+	ups := newUpstreams(3)
+	ups[0].active.Store(2)
+	ups[1].active.Store(0)
+	ups[2].active.Store(1)
+	s := LeastConnections()
+
+	// Test: Upstream with the fewest requests in progress
+	assert.Equal(t, []int{1, 1, 1}, picks(s, ups, []float64{1, 1, 1}, 3))
+
+	// Test: Upstream warming up counts as busier
+	assert.Equal(t, 2, s.pick(ups, []float64{1, 0.25, 1}, nil))
+
+	// Test: Ties are spread out
+	ups[0].active.Store(0)
+	ups[2].active.Store(0)
+	assert.ElementsMatch(t, []int{0, 1, 2}, picks(s, ups, []float64{1, 1, 1}, 3))
+
+	// Test: None available
+	assert.Equal(t, -1, s.pick(ups, []float64{0, 0, 0}, nil))
+}
+
+func TestConsistentHash(t *testing.T) {
+	ups := newUpstreams(4)
+	all := []float64{1, 1, 1, 1}
+	s := ConsistentHash("X-User")
+
+	userReq := func(user string) *request.Request {
+		return newProxyRequest("GET", "/", nil, "X-User", user)
+	}
+
+	// Test: Same key, same upstream
+	first := s.pick(ups, all, userReq("alice"))
+	for range 5 {
+		assert.Equal(t, first, s.pick(ups, all, userReq("alice")))
+	}
+
+	// Test: Keys are spread over the upstreams
+	assigned := map[string]int{}
+	used := map[int]bool{}
+	for i := range 200 {
+		user := fmt.Sprintf("user%d", i)
+		assigned[user] = s.pick(ups, all, userReq(user))
+		used[assigned[user]] = true
+	}
+	assert.Len(t, used, 4)
+
+	// Test: Only the keys of an upstream that goes down move
+	down := []float64{1, 0, 1, 1}
+	for user, i := range assigned {
+		got := s.pick(ups, down, userReq(user))
+		if i == 1 {
+			assert.NotEqual(t, 1, got)
+		} else {
+			assert.Equal(t, i, got, user)
+		}
+	}
+
+	// Test: Keys come back gradually while the upstream warms up
+	back := func(w float64) int {
+		n := 0
+		for user, i := range assigned {
+			if i == 1 && s.pick(ups, []float64{1, w, 1, 1}, userReq(user)) == 1 {
+				n++
+			}
+		}
+		return n
+	}
+	assert.Less(t, back(0.1), back(0.6))
+	assert.Less(t, back(0.6), back(1))
+
+	// Test: Client IP without the field
+	req := newProxyRequest("GET", "/", nil)
+	ip := s.pick(ups, all, req)
+	req.RemoteAddr = "192.0.2.7:40000"
+	assert.Equal(t, ip, s.pick(ups, all, req))
+	assert.Equal(t, ip, ConsistentHash("").pick(ups, all, req))
+
+	// Test: None available
+	assert.Equal(t, -1, s.pick(ups, []float64{0, 0, 0, 0}, &request.Request{Headers: headers.NewHeaders()}))
+}
@@ -0,0 +1,343 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Supasiti/prac-go-http-protocol/internal/client"
+	"github.com/Supasiti/prac-go-http-protocol/internal/headers"
+	"github.com/Supasiti/prac-go-http-protocol/internal/request"
+	"github.com/Supasiti/prac-go-http-protocol/internal/response"
+)
+
+// DefaultAllowedPorts are the destination ports a forward proxy reaches unless told
+// otherwise
+var DefaultAllowedPorts = []int{80, 443}
+
+// via identifies this proxy in the Via field of forwarded requests (RFC 9110 7.6.3)
+const via = "1.1 prac-go-http-protocol"
+
+const authRealm = "proxy"
+
+// errForbiddenAddress is returned when a destination only resolves to addresses the proxy
+// does not reach
+var errForbiddenAddress = errors.New("destination address not allowed")
+
+// ForwardProxy serves clients that use this server as their HTTP proxy. Requests in
+// absolute form are forwarded to the server they name, and CONNECT opens a TCP tunnel.
+type ForwardProxy struct {
+	client       *client.Client
+	dialTimeout  time.Duration
+	allowedHosts []string
+	allowedPorts []int
+	user         string
+	password     string
+
+	privateNetworks bool
+}
+
+type ForwardOption func(*ForwardProxy)
+
+// WithForwardClient sets the client used for plain HTTP requests. The client opens its
+// own connections, so the address checks of the proxy only apply to CONNECT tunnels.
+func WithForwardClient(c *client.Client) ForwardOption {
+	return func(f *ForwardProxy) {
+		f.client = c
+	}
+}
+
+// WithDialTimeout limits how long opening a CONNECT tunnel may take
+func WithDialTimeout(d time.Duration) ForwardOption {
+	return func(f *ForwardProxy) {
+		f.dialTimeout = d
+	}
+}
+
+// WithAllowedHosts limits the destinations to hosts. A pattern such as *.example.com
+// matches any subdomain. Without it every host is allowed.
+func WithAllowedHosts(hosts ...string) ForwardOption {
+	return func(f *ForwardProxy) {
+		f.allowedHosts = hosts
+	}
+}
+
+// WithPrivateNetworks lets clients reach loopback, private and link-local addresses,
+// which are refused otherwise
+func WithPrivateNetworks() ForwardOption {
+	return func(f *ForwardProxy) {
+		f.privateNetworks = true
+	}
+}
+
+// WithAllowedPorts limits the destination ports, DefaultAllowedPorts otherwise
+func WithAllowedPorts(ports ...int) ForwardOption {
+	return func(f *ForwardProxy) {
+		f.allowedPorts = ports
+	}
+}
+
+// WithProxyAuth requires clients to send these credentials in Proxy-Authorization, using
+// the Basic scheme
+func WithProxyAuth(user, password string) ForwardOption {
+	return func(f *ForwardProxy) {
+		f.user = user
+		f.password = password
+	}
+}
+
+func NewForward(opts ...ForwardOption) *ForwardProxy {
+	f := &ForwardProxy{
+		dialTimeout:  client.DefaultDialTimeout,
+		allowedPorts: DefaultAllowedPorts,
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	if f.client == nil {
+		f.client = client.New(client.WithDialTimeout(f.dialTimeout), client.WithDialContext(f.dial))
+	}
+	return f
+}
+
+// IsProxyRequest reports whether req is meant for a forward proxy rather than this server:
+// a CONNECT, or any target that is neither in origin form nor *. Handle answers those in
+// absolute form with a scheme it cannot forward, and anything malformed, with 400.
+func IsProxyRequest(req *request.Request) bool {
+	target := req.RequestLine.RequestTarget
+	return req.RequestLine.Method == "CONNECT" || (!strings.HasPrefix(target, "/") && target != "*")
+}
+
+// Handle serves a CONNECT or an absolute-form request. It has the signature of
+// server.Handler.
+func (f *ForwardProxy) Handle(w *response.Writer, req *request.Request) {
+	if !f.authorized(req) {
+		w.Header().Set("Proxy-Authenticate", `Basic realm="`+authRealm+`"`)
+		writeError(w, response.StatusProxyAuthRequired)
+		return
+	}
+
+	if req.RequestLine.Method == "CONNECT" {
+		f.tunnel(w, req)
+		return
+	}
+	f.forward(w, req)
+}
+
+// forward sends a plain HTTP request on to the server named in its target
+func (f *ForwardProxy) forward(w *response.Writer, req *request.Request) {
+	// url.Parse lowercases the scheme, so HTTP:// is forwarded too
+	u, err := url.Parse(req.RequestLine.RequestTarget)
+	if err != nil || u.Scheme != "http" || u.Host == "" {
+		// https goes through a CONNECT tunnel instead
+		writeError(w, response.StatusBadRequest)
+		return
+	}
+	port := u.Port()
+	if port == "" {
+		port = "80"
+	}
+	if !f.allowed(u.Hostname(), port) {
+		log.Printf("Refusing to forward to %s", u.Host)
+		writeError(w, response.StatusForbidden)
+		return
+	}
+
+	h := headers.NewHeaders()
+	h.Set("Host", u.Host)
+	for name, value := range req.Headers.Fields() {
+		if !strings.EqualFold(name, "Host") {
+			h.Set(name, value)
+		}
+	}
+	removeHopByHop(h)
+	h.Add("Via", via)
+
+	out := &request.Request{
+		RequestLine: &request.RequestLine{Method: req.RequestLine.Method, RequestTarget: u.String(), HttpVersion: "1.1"},
+		Headers:     h,
+		Body:        req.Body,
+		BodyReader:  req.BodyReader,
+	}
+	res, err := f.client.Do(out)
+	if err != nil {
+		log.Printf("Error reaching %s: %s", u.Host, err)
+		writeDialError(w, err)
+		return
+	}
+	defer res.Body.Close()
+
+	if err := copyResponse(w, res); err != nil {
+		log.Printf("Error relaying response from %s: %s", u.Host, err)
+	}
+}
+
+// tunnel connects to the authority in a CONNECT request and, once the client has been
+// told, passes bytes both ways until either side is done
+func (f *ForwardProxy) tunnel(w *response.Writer, req *request.Request) {
+	addr := req.RequestLine.RequestTarget
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || host == "" || port == "" {
+		writeError(w, response.StatusBadRequest)
+		return
+	}
+	if !f.allowed(host, port) {
+		log.Printf("Refusing to tunnel to %s", addr)
+		writeError(w, response.StatusForbidden)
+		return
+	}
+
+	upstream, err := f.dial(context.Background(), "tcp", addr)
+	if err != nil {
+		log.Printf("Error reaching %s: %s", addr, err)
+		writeDialError(w, err)
+		return
+	}
+
+	if err := w.WriteStatusLineReason(response.StatusOk, "Connection Established"); err != nil {
+		upstream.Close()
+		return
+	}
+	if err := w.WriteHeaders(nil); err != nil {
+		upstream.Close()
+		return
+	}
+	conn, buffered, err := w.Hijack()
+	if err != nil {
+		log.Printf("Error taking over the connection: %s", err)
+		upstream.Close()
+		return
+	}
+
+	splice(conn, buffered, upstream)
+}
+
+// splice copies between the two connections until both directions are finished, then
+// closes them. Bytes the client sent right behind the CONNECT go first.
+func splice(conn net.Conn, buffered []byte, upstream net.Conn) {
+	defer conn.Close()
+	defer upstream.Close()
+
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		io.Copy(upstream, io.MultiReader(bytes.NewReader(buffered), conn))
+		closeWrite(upstream)
+	})
+	wg.Go(func() {
+		io.Copy(conn, upstream)
+		closeWrite(conn)
+	})
+	wg.Wait()
+}
+
+// closeWrite tells the other end that no more data is coming, while still reading what it
+// has to send. Connections that cannot half-close are closed.
+func closeWrite(c net.Conn) {
+	if cw, ok := c.(interface{ CloseWrite() error }); ok {
+		cw.CloseWrite()
+		return
+	}
+	c.Close()
+}
+
+// dial connects to addr. The host is resolved once, addresses the proxy does not reach are
+// skipped, and the address that passed is the one dialled, so a second lookup cannot send
+// the connection somewhere else.
+func (f *ForwardProxy) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, f.dialTimeout)
+	defer cancel()
+
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	for _, ip := range ips {
+		if f.reachable(ip.IP) {
+			dialer := &net.Dialer{}
+			return dialer.DialContext(ctx, network, net.JoinHostPort(ip.IP.String(), port))
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", errForbiddenAddress, host)
+}
+
+// reachable reports whether the proxy may connect to ip. Unless WithPrivateNetworks is
+// set, that leaves out this host, the private networks and link-local addresses such as
+// the cloud metadata service.
+func (f *ForwardProxy) reachable(ip net.IP) bool {
+	if f.privateNetworks {
+		return true
+	}
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() && !ip.IsUnspecified() && !ip.IsMulticast()
+}
+
+func (f *ForwardProxy) allowed(host, port string) bool {
+	n, err := strconv.Atoi(port)
+	if err != nil || !slices.Contains(f.allowedPorts, n) {
+		return false
+	}
+	if len(f.allowedHosts) == 0 {
+		return true
+	}
+
+	host = strings.ToLower(strings.Trim(host, "[]"))
+	for _, pattern := range f.allowedHosts {
+		pattern = strings.ToLower(pattern)
+		if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+			if strings.HasSuffix(host, suffix) && len(host) > len(suffix) {
+				return true
+			}
+		} else if host == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+func writeDialError(w *response.Writer, err error) {
+	if errors.Is(err, errForbiddenAddress) {
+		writeError(w, response.StatusForbidden)
+		return
+	}
+	writeUpstreamError(w, err)
+}
+
+func (f *ForwardProxy) authorized(req *request.Request) bool {
+	if f.user == "" && f.password == "" {
+		return true
+	}
+
+	scheme, credentials, _ := strings.Cut(req.Headers.Get("Proxy-Authorization"), " ")
+	if !strings.EqualFold(scheme, "Basic") {
+		return false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(credentials))
+	if err != nil {
+		return false
+	}
+	user, password, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return false
+	}
+
+	// compare both in full so the time taken gives nothing away
+	userOk := subtle.ConstantTimeCompare([]byte(user), []byte(f.user)) == 1
+	passwordOk := subtle.ConstantTimeCompare([]byte(password), []byte(f.password)) == 1
+	return userOk && passwordOk
+}
@@ -0,0 +1,230 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Supasiti/prac-go-http-protocol/internal/request"
+	"github.com/Supasiti/prac-go-http-protocol/internal/response"
+	"github.com/Supasiti/prac-go-http-protocol/internal/server"
+)
+
+func port(t *testing.T, addr string) int {
+	_, p, err := net.SplitHostPort(addr)
+	require.NoError(t, err)
+	n, err := strconv.Atoi(p)
+	require.NoError(t, err)
+	return n
+}
+
+// newEchoServer accepts TCP connections and sends back whatever arrives
+func newEchoServer(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func basicAuth(user, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+}
+
+func TestForwardProxy(t *testing.T) {
+	upstream := newUpstream(t, func(w *response.Writer, req *request.Request) {
+		h := req.Headers
+		body := fmt.Sprintf("%s %s host=%s via=%s auth=%s body=%s", req.RequestLine.Method,
+			req.RequestLine.RequestTarget, h.Get("Host"), h.Get("Via"), h.Get("Proxy-Authorization"), req.Body)
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(response.StatusAccepted)
+		w.WriteBody([]byte(body))
+	})
+	authority := upstream[len("http://"):]
+	f := NewForward(WithAllowedPorts(port(t, authority)), WithAllowedHosts("127.0.0.1", "*.example.com"), WithPrivateNetworks())
+
+	// Test: Absolute-form request is forwarded in origin form
+	req := newProxyRequest("POST", upstream+"/submit?x=1", []byte("data"),
+		"Content-Length", "4", "Proxy-Connection", "keep-alive")
+	assert.True(t, IsProxyRequest(req))
+	res, body := relay(t, f.Handle, req)
+	assert.Equal(t, response.StatusAccepted, res.StatusLine.StatusCode)
+	assert.Equal(t, "POST /submit?x=1 host="+authority+" via="+via+" auth= body=data", body)
+
+	// Test: Origin-form request is not for the proxy
+	req = newProxyRequest("GET", "/submit", nil)
+	assert.False(t, IsProxyRequest(req))
+	res, _ = relay(t, f.Handle, req)
+	assert.Equal(t, response.StatusBadRequest, res.StatusLine.StatusCode)
+
+	// Test: Scheme is matched without case
+	req = newProxyRequest("GET", "HTTP://"+authority+"/upper", nil)
+	assert.True(t, IsProxyRequest(req))
+	res, body = relay(t, f.Handle, req)
+	assert.Equal(t, response.StatusAccepted, res.StatusLine.StatusCode)
+	assert.Contains(t, body, "GET /upper ")
+
+	// Test: Absolute form with a scheme that cannot be forwarded, or malformed
+	for _, target := range []string{"https://" + authority + "/", "ftp://" + authority + "/", "nonsense"} {
+		req = newProxyRequest("GET", target, nil)
+		assert.True(t, IsProxyRequest(req), target)
+		res, _ = relay(t, f.Handle, req)
+		assert.Equal(t, response.StatusBadRequest, res.StatusLine.StatusCode, target)
+	}
+	assert.False(t, IsProxyRequest(newProxyRequest("OPTIONS", "*", nil)))
+
+	// Test: Hosts and ports outside the allowlist
+	for _, target := range []string{
+		"http://localhost:" + strconv.Itoa(port(t, authority)) + "/",
+		"http://127.0.0.1:1/",
+		"http://www.example.com/",
+	} {
+		res, _ = relay(t, f.Handle, newProxyRequest("GET", target, nil))
+		assert.Equal(t, response.StatusForbidden, res.StatusLine.StatusCode, target)
+	}
+	assert.True(t, f.allowed("www.example.com", strconv.Itoa(port(t, authority))))
+	assert.False(t, f.allowed("example.com", strconv.Itoa(port(t, authority))))
+
+	// Test: Unreachable destination
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	dead := l.Addr().String()
+	l.Close()
+	f = NewForward(WithAllowedPorts(port(t, dead)), WithPrivateNetworks())
+	res, _ = relay(t, f.Handle, newProxyRequest("GET", "http://"+dead+"/", nil))
+	assert.Equal(t, response.StatusBadGateway, res.StatusLine.StatusCode)
+}
+
+func TestForwardProxyAuth(t *testing.T) {
+	upstream := newUpstream(t, func(w *response.Writer, req *request.Request) {
+		body := "auth=" + req.Headers.Get("Proxy-Authorization")
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(response.StatusOk)
+		w.WriteBody([]byte(body))
+	})
+	f := NewForward(WithAllowedPorts(port(t, upstream[len("http://"):])), WithProxyAuth("dev", "s3cret"), WithPrivateNetworks())
+
+	// Test: Missing credentials
+	res, _ := relay(t, f.Handle, newProxyRequest("GET", upstream+"/", nil))
+	assert.Equal(t, response.StatusProxyAuthRequired, res.StatusLine.StatusCode)
+	assert.Equal(t, `Basic realm="proxy"`, res.Headers.Get("Proxy-Authenticate"))
+
+	// Test: Wrong credentials
+	for _, auth := range []string{basicAuth("dev", "wrong"), basicAuth("other", "s3cret"), "Bearer token", "Basic !!"} {
+		res, _ = relay(t, f.Handle, newProxyRequest("GET", upstream+"/", nil, "Proxy-Authorization", auth))
+		assert.Equal(t, response.StatusProxyAuthRequired, res.StatusLine.StatusCode, auth)
+	}
+
+	// Test: Right credentials, which are not passed on
+	res, body := relay(t, f.Handle, newProxyRequest("GET", upstream+"/", nil, "Proxy-Authorization", basicAuth("dev", "s3cret")))
+	assert.Equal(t, response.StatusOk, res.StatusLine.StatusCode)
+	assert.Equal(t, "auth=", body)
+}
+
+func TestForwardProxyConnect(t *testing.T) {
+	echo := newEchoServer(t)
+	f := NewForward(WithAllowedPorts(port(t, echo)), WithProxyAuth("dev", "s3cret"), WithPrivateNetworks())
+	s, err := server.Serve(0, f.Handle)
+	require.NoError(t, err)
+	defer s.Close()
+	proxyAddr := fmt.Sprintf("127.0.0.1:%d", s.Addr().(*net.TCPAddr).Port)
+
+	connect := func(target, extra string) (net.Conn, *bufio.Reader, *response.Response) {
+		conn, err := net.Dial("tcp", proxyAddr)
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		_, err = io.WriteString(conn, "CONNECT "+target+" HTTP/1.1\r\n"+
+			"Host: "+target+"\r\n"+
+			"Proxy-Authorization: "+basicAuth("dev", "s3cret")+"\r\n"+
+			"\r\n"+extra)
+		require.NoError(t, err)
+		br := bufio.NewReader(conn)
+		res, err := response.ResponseFromReader(br, "CONNECT")
+		require.NoError(t, err)
+		return conn, br, res
+	}
+
+	// Test: Tunnel carries bytes both ways, including those sent right behind the request
+	conn, br, res := connect(echo, "early,")
+	assert.Equal(t, response.StatusOk, res.StatusLine.StatusCode)
+	assert.Equal(t, "Connection Established", res.StatusLine.ReasonPhrase)
+	assert.Equal(t, "", res.Headers.Get("Content-Length"))
+	assert.Equal(t, "", res.Headers.Get("Transfer-Encoding"))
+	_, err = io.WriteString(conn, "late")
+	require.NoError(t, err)
+	conn.(*net.TCPConn).CloseWrite()
+	rest, err := io.ReadAll(br)
+	require.NoError(t, err)
+	assert.Equal(t, "early,late", string(rest))
+
+	// Test: Port outside the allowlist
+	_, _, res = connect("127.0.0.1:1", "")
+	assert.Equal(t, response.StatusForbidden, res.StatusLine.StatusCode)
+
+	// Test: Authority without a port
+	_, _, res = connect("127.0.0.1", "")
+	assert.Equal(t, response.StatusBadRequest, res.StatusLine.StatusCode)
+
+	// Test: Unreachable destination
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	dead := l.Addr().String()
+	l.Close()
+	f.allowedPorts = append(f.allowedPorts, port(t, dead))
+	_, _, res = connect(dead, "")
+	assert.Equal(t, response.StatusBadGateway, res.StatusLine.StatusCode)
+}
+
+func TestForwardProxyPrivateAddresses(t *testing.T) {
+	echo := newEchoServer(t)
+	upstream := newUpstream(t, func(w *response.Writer, req *request.Request) {
+		w.Header().Set("Content-Length", "2")
+		w.WriteHeader(response.StatusOk)
+		w.WriteBody([]byte("ok"))
+	})
+	f := NewForward(WithAllowedPorts(port(t, echo), port(t, upstream[len("http://"):])))
+	s, err := server.Serve(0, f.Handle)
+	require.NoError(t, err)
+	defer s.Close()
+
+	// Test: CONNECT to loopback is refused, by address or by a name resolving to it
+	for _, target := range []string{echo, "localhost:" + strconv.Itoa(port(t, echo))} {
+		conn, err := net.Dial("tcp", s.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+		_, err = io.WriteString(conn, "CONNECT "+target+" HTTP/1.1\r\nHost: "+target+"\r\n\r\n")
+		require.NoError(t, err)
+		res, err := response.ResponseFromReader(bufio.NewReader(conn), "CONNECT")
+		require.NoError(t, err)
+		assert.Equal(t, response.StatusForbidden, res.StatusLine.StatusCode, target)
+	}
+
+	// Test: Plain requests to loopback are refused too
+	res, _ := relay(t, f.Handle, newProxyRequest("GET", upstream+"/", nil))
+	assert.Equal(t, response.StatusForbidden, res.StatusLine.StatusCode)
+
+	// Test: Private, link-local and unspecified addresses
+	for _, ip := range []string{"10.0.0.1", "192.168.1.1", "169.254.169.254", "0.0.0.0", "::1", "fe80::1", "::ffff:127.0.0.1"} {
+		assert.False(t, f.reachable(net.ParseIP(ip)), ip)
+	}
+	assert.True(t, f.reachable(net.ParseIP("93.184.215.14")))
+}
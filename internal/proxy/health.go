@@ -0,0 +1,155 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Supasiti/prac-go-http-protocol/internal/client"
+)
+
+const (
+	// DefaultMaxFails is how many requests in a row may fail before an upstream is ejected
+	DefaultMaxFails = 3
+
+	// DefaultFailTimeout is how long an ejected upstream is left alone when there are no
+	// active health checks to bring it back
+	DefaultFailTimeout = 10 * time.Second
+)
+
+// minWeight is the share an upstream gets as soon as it recovers during slow start
+const minWeight = 0.1
+
+// maxProbeBody bounds how much of a health check response is read
+const maxProbeBody = 64 * 1024
+
+// upstream is one backend of a proxy and what the proxy has learned about it
+type upstream struct {
+	url    *url.URL
+	active atomic.Int64 // requests in progress
+
+	mu        sync.Mutex
+	down      bool
+	fails     int       // requests failed in a row
+	downSince time.Time // when it was taken out
+	upSince   time.Time // when it last recovered, for slow start
+}
+
+// weight reports how much traffic u can take at now, from 0 when it is down to 1 in full
+// service. An upstream taken out passively is given another chance after retryAfter, if
+// that is set.
+func (u *upstream) weight(now time.Time, retryAfter, slowStart time.Duration) float64 {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.down {
+		if retryAfter <= 0 || now.Sub(u.downSince) < retryAfter {
+			return 0
+		}
+		u.recover(now)
+	}
+	if slowStart <= 0 || u.upSince.IsZero() {
+		return 1
+	}
+	elapsed := now.Sub(u.upSince)
+	if elapsed >= slowStart {
+		return 1
+	}
+	return max(minWeight, float64(elapsed)/float64(slowStart))
+}
+
+// report records the outcome of a request. maxFails failures in a row take u out; zero
+// never does.
+func (u *upstream) report(ok bool, now time.Time, maxFails int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if ok {
+		u.fails = 0
+		return
+	}
+	u.fails++
+	if maxFails > 0 && u.fails >= maxFails && !u.down {
+		log.Printf("Ejecting upstream %s after %d failures", u.url.Host, u.fails)
+		u.down = true
+		u.downSince = now
+	}
+}
+
+// setHealthy records the outcome of an active health check
+func (u *upstream) setHealthy(ok bool, now time.Time) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if ok && u.down {
+		u.recover(now)
+	} else if !ok && !u.down {
+		log.Printf("Upstream %s failed its health check", u.url.Host)
+		u.down = true
+		u.downSince = now
+	}
+}
+
+func (u *upstream) recover(now time.Time) {
+	log.Printf("Upstream %s is back", u.url.Host)
+	u.down = false
+	u.fails = 0
+	u.upSince = now
+}
+
+// checkHealth probes every upstream each interval until ctx is done
+func (p *ReverseProxy) checkHealth(ctx context.Context) {
+	ticker := time.NewTicker(p.healthInterval)
+	defer ticker.Stop()
+
+	for {
+		var wg sync.WaitGroup
+		for _, u := range p.upstreams {
+			wg.Go(func() {
+				ok := p.probe(ctx, u)
+				if ctx.Err() == nil {
+					u.setHealthy(ok, p.now())
+				}
+			})
+		}
+		wg.Wait()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// probe asks u for the health check path. Any 2xx or 3xx answer within the interval
+// counts as healthy.
+func (p *ReverseProxy) probe(ctx context.Context, u *upstream) bool {
+	ctx, cancel := context.WithTimeout(ctx, min(p.healthInterval, p.timeout))
+	defer cancel()
+
+	target := *u.url
+	reqPath, query, _ := strings.Cut(p.healthPath, "?")
+	target.Path = joinPath(u.url.Path, reqPath)
+	target.RawPath = ""
+	target.RawQuery = query
+
+	req, err := client.NewRequest("GET", target.String(), nil)
+	if err != nil {
+		return false
+	}
+	res, err := p.client.DoContext(ctx, req)
+	if err != nil {
+		return false
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, maxProbeBody))
+
+	code := res.StatusLine.StatusCode
+	return code >= 200 && code < 400
+}
@@ -0,0 +1,164 @@
+package proxy
+
+import (
+	"net"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Supasiti/prac-go-http-protocol/internal/request"
+	"github.com/Supasiti/prac-go-http-protocol/internal/response"
+)
+
+func TestUpstreamState(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	u := &upstream{url: &url.URL{Scheme: "http", Host: "backend:80"}}
+
+	// Test: Ejected after max fails in a row
+	u.report(false, start, 3)
+	u.report(false, start, 3)
+	u.report(true, start, 3)
+	u.report(false, start, 3)
+	u.report(false, start, 3)
+	assert.Equal(t, 1.0, u.weight(start, time.Minute, 0))
+	u.report(false, start, 3)
+	assert.Equal(t, 0.0, u.weight(start, time.Minute, 0))
+
+	// Test: Tried again after the fail timeout, warming up
+	assert.Equal(t, 0.0, u.weight(start.Add(59*time.Second), time.Minute, 10*time.Second))
+	back := start.Add(time.Minute)
+	assert.Equal(t, minWeight, u.weight(back, time.Minute, 10*time.Second))
+	assert.InDelta(t, 0.5, u.weight(back.Add(5*time.Second), time.Minute, 10*time.Second), 0.001)
+	assert.Equal(t, 1.0, u.weight(back.Add(10*time.Second), time.Minute, 10*time.Second))
+
+	// Test: Zero max fails never ejects
+	for range 10 {
+		u.report(false, back, 0)
+	}
+	assert.Equal(t, 1.0, u.weight(back, time.Minute, 0))
+
+	// Test: Health checks take out and bring back
+	u.setHealthy(false, back)
+	assert.Equal(t, 0.0, u.weight(back.Add(time.Hour), 0, 0))
+	u.setHealthy(true, back.Add(time.Hour))
+	assert.Equal(t, 1.0, u.weight(back.Add(time.Hour), 0, 0))
+}
+
+func TestReverseProxyPassiveEjection(t *testing.T) {
+	live := newUpstream(t, func(w *response.Writer, req *request.Request) {
+		w.Header().Set("Content-Length", "4")
+		w.WriteHeader(response.StatusOk)
+		w.WriteBody([]byte("live"))
+	})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	dead := "http://" + l.Addr().String()
+	l.Close()
+
+	now := time.Now()
+	p, err := NewPool([]string{dead, live}, WithMaxFails(2), WithFailTimeout(time.Minute))
+	require.NoError(t, err)
+	p.now = func() time.Time { return now }
+	defer p.Close()
+
+	statuses := func(n int) []response.StatusCode {
+		got := make([]response.StatusCode, n)
+		for i := range got {
+			res, _ := relay(t, p.Handle, newProxyRequest("GET", "/", nil))
+			got[i] = res.StatusLine.StatusCode
+		}
+		return got
+	}
+
+	// Test: Dead upstream fails until it is ejected
+	assert.Equal(t, []response.StatusCode{
+		response.StatusBadGateway, response.StatusOk,
+		response.StatusBadGateway, response.StatusOk,
+		response.StatusOk, response.StatusOk,
+	}, statuses(6))
+
+	// Test: Tried again after the fail timeout
+	now = now.Add(time.Minute)
+	assert.Contains(t, statuses(2), response.StatusBadGateway)
+}
+
+func TestReverseProxyHealthCheck(t *testing.T) {
+	var healthy atomic.Bool
+	healthy.Store(true)
+	flaky := newUpstream(t, func(w *response.Writer, req *request.Request) {
+		status := response.StatusOk
+		if req.RequestLine.RequestTarget == "/healthz" && !healthy.Load() {
+			status = response.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Length", "5")
+		w.WriteHeader(status)
+		w.WriteBody([]byte("flaky"))
+	})
+	steady := newUpstream(t, func(w *response.Writer, req *request.Request) {
+		w.Header().Set("Content-Length", "6")
+		w.WriteHeader(response.StatusOk)
+		w.WriteBody([]byte("steady"))
+	})
+
+	p, err := NewPool([]string{flaky, steady}, WithHealthCheck("/healthz", 10*time.Millisecond))
+	require.NoError(t, err)
+	defer p.Close()
+
+	bodies := func(n int) map[string]int {
+		got := map[string]int{}
+		for range n {
+			_, body := relay(t, p.Handle, newProxyRequest("GET", "/", nil))
+			got[body]++
+		}
+		return got
+	}
+
+	// Test: Both in service
+	assert.Equal(t, map[string]int{"flaky": 2, "steady": 2}, bodies(4))
+
+	// Test: Failing the check takes it out
+	healthy.Store(false)
+	assert.Eventually(t, func() bool {
+		return p.upstreams[0].weight(time.Now(), 0, 0) == 0
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, map[string]int{"steady": 4}, bodies(4))
+
+	// Test: Passing again brings it back
+	healthy.Store(true)
+	assert.Eventually(t, func() bool { return bodies(2)["flaky"] > 0 }, time.Second, 5*time.Millisecond)
+}
+
+func TestReverseProxyNoUpstream(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	dead := "http://" + l.Addr().String()
+	l.Close()
+
+	p, err := NewPool([]string{dead, dead + "/other"}, WithMaxFails(1))
+	require.NoError(t, err)
+	defer p.Close()
+
+	// Test: All upstreams ejected
+	res, _ := relay(t, p.Handle, newProxyRequest("GET", "/", nil))
+	assert.Equal(t, response.StatusBadGateway, res.StatusLine.StatusCode)
+	res, _ = relay(t, p.Handle, newProxyRequest("GET", "/", nil))
+	assert.Equal(t, response.StatusBadGateway, res.StatusLine.StatusCode)
+	res, _ = relay(t, p.Handle, newProxyRequest("GET", "/", nil))
+	assert.Equal(t, response.StatusServiceUnavailable, res.StatusLine.StatusCode)
+
+	// Test: A lone upstream is never ejected
+	p, err = New(dead, WithMaxFails(1))
+	require.NoError(t, err)
+	for range 3 {
+		res, _ = relay(t, p.Handle, newProxyRequest("GET", "/", nil))
+		assert.Equal(t, response.StatusBadGateway, res.StatusLine.StatusCode)
+	}
+
+	// Test: No upstreams
+	_, err = NewPool(nil)
+	require.Error(t, err)
+}
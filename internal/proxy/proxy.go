@@ -0,0 +1,442 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Supasiti/prac-go-http-protocol/internal/client"
+	"github.com/Supasiti/prac-go-http-protocol/internal/headers"
+	"github.com/Supasiti/prac-go-http-protocol/internal/request"
+	"github.com/Supasiti/prac-go-http-protocol/internal/response"
+)
+
+// DefaultTimeout is how long the upstream has to start answering
+const DefaultTimeout = 30 * time.Second
+
+const copyBufferSize = 32 * 1024
+
+// hopByHop fields describe a single connection and are not forwarded (RFC 9110 7.6.1)
+var hopByHop = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Connection",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"TE",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// ReverseProxy forwards requests to a pool of upstream servers and relays their responses
+type ReverseProxy struct {
+	upstreams   []*upstream
+	strategy    Strategy
+	client      *client.Client
+	stripPrefix string
+	timeout     time.Duration
+
+	healthPath     string
+	healthInterval time.Duration
+	maxFails       int
+	failTimeout    time.Duration
+	slowStart      time.Duration
+
+	now    func() time.Time
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+type Option func(*ReverseProxy)
+
+// WithClient sets the client used to reach the upstream
+func WithClient(c *client.Client) Option {
+	return func(p *ReverseProxy) {
+		p.client = c
+	}
+}
+
+// WithStripPrefix removes prefix from the request path before it is appended to the
+// upstream path, e.g. /httpbin/get goes to https://httpbin.org/get
+func WithStripPrefix(prefix string) Option {
+	return func(p *ReverseProxy) {
+		p.stripPrefix = strings.TrimSuffix(prefix, "/")
+	}
+}
+
+// WithTimeout limits how long the upstream may take to send its response headers. A slow
+// upstream is answered with 504.
+func WithTimeout(d time.Duration) Option {
+	return func(p *ReverseProxy) {
+		p.timeout = d
+	}
+}
+
+// WithStrategy sets how requests are spread over the upstreams. The default is RoundRobin.
+func WithStrategy(s Strategy) Option {
+	return func(p *ReverseProxy) {
+		p.strategy = s
+	}
+}
+
+// WithHealthCheck asks every upstream for path each interval. Upstreams that fail are
+// taken out until they pass again.
+func WithHealthCheck(path string, interval time.Duration) Option {
+	return func(p *ReverseProxy) {
+		p.healthPath = path
+		p.healthInterval = interval
+	}
+}
+
+// WithMaxFails takes an upstream out once n requests in a row could not reach it. Zero
+// disables passive ejection.
+func WithMaxFails(n int) Option {
+	return func(p *ReverseProxy) {
+		p.maxFails = n
+	}
+}
+
+// WithFailTimeout sets how long an ejected upstream is left out before it is tried again.
+// With health checks, passing a check brings it back instead.
+func WithFailTimeout(d time.Duration) Option {
+	return func(p *ReverseProxy) {
+		p.failTimeout = d
+	}
+}
+
+// WithSlowStart ramps a recovered upstream up to its full share of traffic over d, rather
+// than sending it everything at once
+func WithSlowStart(d time.Duration) Option {
+	return func(p *ReverseProxy) {
+		p.slowStart = d
+	}
+}
+
+// New returns a proxy for the upstream at target, an http or https URL whose path is
+// prepended to every forwarded path
+func New(target string, opts ...Option) (*ReverseProxy, error) {
+	return NewPool([]string{target}, opts...)
+}
+
+// NewPool returns a proxy spreading requests over the upstreams at targets. Call Close to
+// stop the health checks.
+func NewPool(targets []string, opts ...Option) (*ReverseProxy, error) {
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no upstreams")
+	}
+
+	p := &ReverseProxy{
+		timeout:     DefaultTimeout,
+		maxFails:    DefaultMaxFails,
+		failTimeout: DefaultFailTimeout,
+		now:         time.Now,
+	}
+	for _, target := range targets {
+		u, err := url.Parse(target)
+		if err != nil {
+			return nil, err
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("unsupported upstream: %s", target)
+		}
+		p.upstreams = append(p.upstreams, &upstream{url: u})
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+	if p.client == nil {
+		p.client = client.New(client.WithResponseHeaderTimeout(p.timeout))
+	}
+	if p.strategy == nil {
+		p.strategy = RoundRobin()
+	}
+
+	if p.healthPath != "" && p.healthInterval > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		p.cancel = cancel
+		p.wg.Go(func() { p.checkHealth(ctx) })
+	}
+	return p, nil
+}
+
+// Close stops the health checks
+func (p *ReverseProxy) Close() error {
+	if p.cancel != nil {
+		p.cancel()
+		p.wg.Wait()
+	}
+	return nil
+}
+
+// Handle forwards req to one of the upstreams and copies its response to w. It has the
+// signature of server.Handler. Responses are streamed, but request bodies are not: the
+// server reads the whole body before calling the handler, so it is sent on from Body.
+// A BodyReader set by another caller is streamed.
+func (p *ReverseProxy) Handle(w *response.Writer, req *request.Request) {
+	u := p.pick(req)
+	if u == nil {
+		log.Printf("No upstream available for %s", req.RequestLine.RequestTarget)
+		writeError(w, response.StatusServiceUnavailable)
+		return
+	}
+	u.active.Add(1)
+	defer u.active.Add(-1)
+
+	out, err := p.outgoing(req, u.url)
+	if err != nil {
+		log.Printf("Error building upstream request: %s", err)
+		writeError(w, response.StatusBadRequest)
+		return
+	}
+
+	res, err := p.client.Do(out)
+	if err != nil {
+		log.Printf("Error reaching upstream %s: %s", u.url.Host, err)
+		p.report(u, false)
+		writeUpstreamError(w, err)
+		return
+	}
+	p.report(u, true)
+	defer res.Body.Close()
+
+	if err := copyResponse(w, res); err != nil {
+		// the status line is out already, all that is left is to cut the response short
+		log.Printf("Error relaying response from %s: %s", u.url.Host, err)
+	}
+}
+
+// pick chooses the upstream for req, or nil if all of them are down
+func (p *ReverseProxy) pick(req *request.Request) *upstream {
+	// with health checks, only a passing check brings an upstream back
+	retryAfter := p.failTimeout
+	if p.cancel != nil {
+		retryAfter = 0
+	}
+
+	now := p.now()
+	weights := make([]float64, len(p.upstreams))
+	for i, u := range p.upstreams {
+		weights[i] = u.weight(now, retryAfter, p.slowStart)
+	}
+	i := p.strategy.pick(p.upstreams, weights, req)
+	if i < 0 {
+		return nil
+	}
+	return p.upstreams[i]
+}
+
+// report records whether a request reached u. A lone upstream is never ejected passively,
+// as there is nowhere else to send its traffic.
+func (p *ReverseProxy) report(u *upstream, ok bool) {
+	maxFails := p.maxFails
+	if len(p.upstreams) == 1 {
+		maxFails = 0
+	}
+	u.report(ok, p.now(), maxFails)
+}
+
+// outgoing builds the request to the upstream: the target path joined to the upstream
+// path, end-to-end fields only, and the forwarding fields describing the client
+func (p *ReverseProxy) outgoing(req *request.Request, target *url.URL) (*request.Request, error) {
+	reqPath, query, _ := strings.Cut(req.RequestLine.RequestTarget, "?")
+	if !strings.HasPrefix(reqPath, "/") {
+		return nil, fmt.Errorf("request target not in origin form: %s", req.RequestLine.RequestTarget)
+	}
+	if p.stripPrefix != "" {
+		reqPath = strings.TrimPrefix(reqPath, p.stripPrefix)
+	}
+
+	u := *target
+	u.Path = joinPath(target.Path, reqPath)
+	u.RawPath = ""
+	u.RawQuery = query
+	if target.RawQuery != "" && query != "" {
+		u.RawQuery = target.RawQuery + "&" + query
+	} else if target.RawQuery != "" {
+		u.RawQuery = target.RawQuery
+	}
+
+	h := headers.NewHeaders()
+	h.Set("Host", target.Host)
+	for name, value := range req.Headers.Fields() {
+		if !strings.EqualFold(name, "Host") {
+			h.Set(name, value)
+		}
+	}
+	removeHopByHop(h)
+	addForwarded(h, req)
+
+	out := &request.Request{
+		RequestLine: &request.RequestLine{Method: req.RequestLine.Method, RequestTarget: u.String(), HttpVersion: "1.1"},
+		Headers:     h,
+		Body:        req.Body,
+		BodyReader:  req.BodyReader,
+	}
+	if out.BodyReader != nil {
+		// the length may not hold once the body is streamed on
+		h.Remove("Content-Length")
+	}
+	return out, nil
+}
+
+// addForwarded records the client and the host it asked for, in Forwarded (RFC 7239) and
+// the de facto X-Forwarded-* fields
+func addForwarded(h *headers.Headers, req *request.Request) {
+	clientIP := clientIP(req)
+	host := req.Headers.Get("Host")
+
+	if clientIP != "" {
+		forNode := clientIP
+		if strings.Contains(clientIP, ":") {
+			forNode = `"[` + clientIP + `]"`
+		}
+		element := "for=" + forNode
+		if host != "" {
+			element += ";host=" + quote(host)
+		}
+		element += ";proto=http"
+		h.Add("Forwarded", element)
+		h.Add("X-Forwarded-For", clientIP)
+	}
+	if host != "" {
+		h.Set("X-Forwarded-Host", host)
+	}
+	h.Set("X-Forwarded-Proto", "http")
+}
+
+// quote makes s a quoted-string, escaping " and \ as quoted-pairs (RFC 9110 5.6.4), so a
+// hostile value cannot end the string and add parameters of its own
+func quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, c := range []byte(s) {
+		if c == '"' || c == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(c)
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// clientIP returns the address the request came from, without the port
+func clientIP(req *request.Request) string {
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		return host
+	}
+	return req.RemoteAddr
+}
+
+func removeHopByHop(h *headers.Headers) {
+	// fields named in Connection are hop-by-hop too
+	for name := range strings.SplitSeq(h.Get("Connection"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			h.Remove(name)
+		}
+	}
+	for _, name := range hopByHop {
+		h.Remove(name)
+	}
+}
+
+// copyResponse relays the upstream status, fields and body. Bodies are flushed as they
+// arrive, so streams such as server-sent events pass through.
+func copyResponse(w *response.Writer, res *response.Response) error {
+	h := res.Headers
+	chunked := isChunked(h)
+	removeHopByHop(h)
+	if chunked {
+		h.Set("Transfer-Encoding", "chunked")
+	}
+
+	if err := w.WriteStatusLineReason(res.StatusLine.StatusCode, res.StatusLine.ReasonPhrase); err != nil {
+		return err
+	}
+	if err := w.WriteHeaders(h); err != nil {
+		return err
+	}
+
+	buf := make([]byte, copyBufferSize)
+	for {
+		n, err := res.Body.Read(buf)
+		if n > 0 {
+			if werr := writeBody(w, buf[:n], chunked); werr != nil {
+				return werr
+			}
+			if werr := w.Flush(); werr != nil {
+				return werr
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if chunked {
+		if _, err := w.WriteChunkBodyDone(); err != nil {
+			return err
+		}
+		return w.WriteTrailers(w.AllowedTrailers(res.Trailers))
+	}
+	return nil
+}
+
+func writeBody(w *response.Writer, p []byte, chunked bool) error {
+	if chunked {
+		_, err := w.WriteChunkBody(p)
+		return err
+	}
+	_, err := w.WriteBody(p)
+	return err
+}
+
+func isChunked(h *headers.Headers) bool {
+	codings := strings.Split(h.Get("Transfer-Encoding"), ",")
+	return strings.EqualFold(strings.TrimSpace(codings[len(codings)-1]), "chunked")
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded) ||
+		(errors.As(err, &netErr) && netErr.Timeout())
+}
+
+func joinPath(base, p string) string {
+	if base == "" || base == "/" {
+		return p
+	}
+	joined := path.Join(base, p)
+	if strings.HasSuffix(p, "/") && !strings.HasSuffix(joined, "/") {
+		joined += "/"
+	}
+	return joined
+}
+
+// writeUpstreamError answers with 504 when the upstream was too slow and 502 otherwise
+func writeUpstreamError(w *response.Writer, err error) {
+	if isTimeout(err) {
+		writeError(w, response.StatusGatewayTimeout)
+	} else {
+		writeError(w, response.StatusBadGateway)
+	}
+}
+
+func writeError(w *response.Writer, status response.StatusCode) {
+	body := []byte(response.StatusText(status) + "\n")
+	w.WriteStatusLine(status)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+}
@@ -0,0 +1,206 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Supasiti/prac-go-http-protocol/internal/headers"
+	"github.com/Supasiti/prac-go-http-protocol/internal/request"
+	"github.com/Supasiti/prac-go-http-protocol/internal/response"
+	"github.com/Supasiti/prac-go-http-protocol/internal/server"
+)
+
+// newUpstream starts a stand-in upstream on a free port and returns its URL
+func newUpstream(t *testing.T, handler server.Handler) string {
+	s, err := server.Serve(0, handler)
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	return fmt.Sprintf("http://127.0.0.1:%d", s.Addr().(*net.TCPAddr).Port)
+}
+
+// newRawUpstream starts an upstream that answers every request with raw, for responses
+// the response writer would refuse to produce
+func newRawUpstream(t *testing.T, raw string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, err := request.RequestFromReader(conn)
+				if err == nil {
+					io.WriteString(conn, raw)
+				}
+			}()
+		}
+	}()
+	return "http://" + l.Addr().String()
+}
+
+func newProxyRequest(method, target string, body []byte, fields ...string) *request.Request {
+	h := headers.NewHeaders()
+	h.Set("Host", "proxy.local")
+	for i := 0; i+1 < len(fields); i += 2 {
+		h.Set(fields[i], fields[i+1])
+	}
+	return &request.Request{
+		RequestLine: &request.RequestLine{Method: method, RequestTarget: target, HttpVersion: "1.1"},
+		Headers:     h,
+		Body:        body,
+		RemoteAddr:  "192.0.2.7:51234",
+	}
+}
+
+// relay sends req through handler and parses what the client would receive
+func relay(t *testing.T, handler server.Handler, req *request.Request) (*response.Response, string) {
+	buf := &bytes.Buffer{}
+	w := response.NewWriter(buf)
+	w.SetRequestMethod(req.RequestLine.Method)
+	handler(w, req)
+	require.NoError(t, w.Close())
+
+	res, err := response.ResponseFromReader(buf, req.RequestLine.Method)
+	require.NoError(t, err)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	return res, string(body)
+}
+
+func TestReverseProxy(t *testing.T) {
+	upstream := newUpstream(t, func(w *response.Writer, req *request.Request) {
+		h := req.Headers
+		body := fmt.Sprintf("%s %s\nhost=%s\nforwarded=%s\nxff=%s\nxfh=%s\nsecret=%s\nbody=%s",
+			req.RequestLine.Method, req.RequestLine.RequestTarget, h.Get("Host"), h.Get("Forwarded"),
+			h.Get("X-Forwarded-For"), h.Get("X-Forwarded-Host"), h.Get("X-Secret"), req.Body)
+		w.Header().Set("X-Upstream", "yes")
+		w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+		w.WriteHeader(response.StatusCreated)
+		w.WriteBody([]byte(body))
+	})
+	p, err := New(upstream+"/base", WithStripPrefix("/api"))
+	require.NoError(t, err)
+
+	// Test: Method, path, body and forwarding fields reach the upstream
+	req := newProxyRequest("POST", "/api/items?x=1", []byte("payload"),
+		"Content-Length", "7", "Connection", "X-Secret", "X-Secret", "hop")
+	res, body := relay(t, p.Handle, req)
+	assert.Equal(t, response.StatusCreated, res.StatusLine.StatusCode)
+	assert.Equal(t, "yes", res.Headers.Get("X-Upstream"))
+	assert.Equal(t, "POST /base/items?x=1\n"+
+		"host="+strings.TrimPrefix(upstream, "http://")+"\n"+
+		`forwarded=for=192.0.2.7;host="proxy.local";proto=http`+"\n"+
+		"xff=192.0.2.7\n"+
+		"xfh=proxy.local\n"+
+		"secret=\n"+
+		"body=payload", body)
+
+	// Test: Hostile Host stays inside its quoted-string
+	req = newProxyRequest("GET", "/api/", nil)
+	req.Headers.Set("Host", `evil";for=10.0.0.1;x="\`)
+	_, body = relay(t, p.Handle, req)
+	assert.Contains(t, body, `forwarded=for=192.0.2.7;host="evil\";for=10.0.0.1;x=\"\\";proto=http`+"\n")
+
+	// Test: Existing forwarding fields are appended to
+	req = newProxyRequest("GET", "/api/", nil, "X-Forwarded-For", "198.51.100.1")
+	_, body = relay(t, p.Handle, req)
+	assert.Contains(t, body, "xff=198.51.100.1, 192.0.2.7\n")
+	assert.Contains(t, body, "GET /base/\n")
+}
+
+func TestReverseProxyStreaming(t *testing.T) {
+	upstream := newUpstream(t, func(w *response.Writer, req *request.Request) {
+		h := headers.NewHeaders()
+		h.Set("Transfer-Encoding", "chunked")
+		h.Set("Trailer", "X-Count")
+		w.WriteStatusLine(response.StatusOk)
+		w.WriteHeaders(h)
+		w.WriteChunkBody([]byte("one,"))
+		w.WriteChunkBody([]byte("two"))
+		w.WriteChunkBodyDone()
+		trailers := headers.NewHeaders()
+		trailers.Set("X-Count", "2")
+		w.WriteTrailers(trailers)
+	})
+	p, err := New(upstream)
+	require.NoError(t, err)
+
+	// Test: Chunked body and trailers pass through
+	res, body := relay(t, p.Handle, newProxyRequest("GET", "/stream", nil))
+	assert.Equal(t, response.StatusOk, res.StatusLine.StatusCode)
+	assert.Equal(t, "one,two", body)
+	assert.Equal(t, "2", res.Trailers.Get("X-Count"))
+
+	// Test: HEAD gets the headers only
+	res, body = relay(t, p.Handle, newProxyRequest("HEAD", "/stream", nil))
+	assert.Equal(t, response.StatusOk, res.StatusLine.StatusCode)
+	assert.Equal(t, "", body)
+
+	// Test: Undeclared and forbidden trailers are dropped, declared ones kept
+	upstream = newRawUpstream(t, "HTTP/1.1 200 OK\r\n"+
+		"Transfer-Encoding: chunked\r\n"+
+		"Trailer: X-Count, Set-Cookie\r\n"+
+		"\r\n"+
+		"3\r\none\r\n"+
+		"0\r\n"+
+		"X-Count: 1\r\n"+
+		"X-Stray: yes\r\n"+
+		"Set-Cookie: a=b\r\n"+
+		"\r\n")
+	p, err = New(upstream)
+	require.NoError(t, err)
+	res, body = relay(t, p.Handle, newProxyRequest("GET", "/stream", nil))
+	assert.Equal(t, "one", body)
+	assert.Equal(t, "1", res.Trailers.Get("X-Count"))
+	assert.Equal(t, "", res.Trailers.Get("X-Stray"))
+	assert.Equal(t, "", res.Trailers.Get("Set-Cookie"))
+}
+
+func TestReverseProxyFailures(t *testing.T) {
+	// Test: Upstream refusing connections is a bad gateway
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	l.Close()
+	p, err := New("http://" + addr)
+	require.NoError(t, err)
+	res, _ := relay(t, p.Handle, newProxyRequest("GET", "/", nil))
+	assert.Equal(t, response.StatusBadGateway, res.StatusLine.StatusCode)
+
+	// Test: Upstream too slow to answer is a gateway timeout
+	release := make(chan struct{})
+	defer close(release)
+	upstream := newUpstream(t, func(w *response.Writer, req *request.Request) {
+		<-release
+	})
+	p, err = New(upstream, WithTimeout(20*time.Millisecond))
+	require.NoError(t, err)
+	res, _ = relay(t, p.Handle, newProxyRequest("GET", "/", nil))
+	assert.Equal(t, response.StatusGatewayTimeout, res.StatusLine.StatusCode)
+
+	// Test: Upstream status codes are passed on, not replaced
+	upstream = newUpstream(t, func(w *response.Writer, req *request.Request) {
+		w.Header().Set("Content-Length", "0")
+		w.WriteHeader(response.StatusNotFound)
+	})
+	p, err = New(upstream)
+	require.NoError(t, err)
+	res, _ = relay(t, p.Handle, newProxyRequest("GET", "/missing", nil))
+	assert.Equal(t, response.StatusNotFound, res.StatusLine.StatusCode)
+
+	// Test: Unsupported upstream
+	_, err = New("ftp://example.com")
+	require.Error(t, err)
+}
@@ -33,7 +33,19 @@ type Request struct {
 	RequestLine *RequestLine
 	Headers     *headers.Headers
 	Body        []byte
-	state       parserState
+
+	// BodyReader streams the body of an outgoing request instead of Body. It is sent with
+	// chunked transfer coding unless Headers has a Content-Length.
+	BodyReader io.Reader
+
+	// Trailers are sent after a chunked body of an outgoing request
+	Trailers *headers.Headers
+
+	// RemoteAddr is the address of the client, set by the server
+	RemoteAddr string
+
+	state    parserState
+	buffered []byte
 }
 
 func newRequest() *Request {
@@ -94,16 +106,18 @@ func (r *Request) parseLine(p []byte) (int, error) {
 		if err != nil {
 			return 0, fmt.Errorf("malform content-length: %s", err)
 		}
-
-		r.Body = append(r.Body, p...)
-		if contentLength < len(r.Body) {
-			return 0, fmt.Errorf("body length too large")
+		if contentLength < 0 {
+			return 0, fmt.Errorf("malform content-length: %d", contentLength)
 		}
 
+		// anything past the body belongs to whatever comes next on the connection
+		n := min(contentLength-len(r.Body), len(p))
+		r.Body = append(r.Body, p[:n]...)
+
 		if contentLength == len(r.Body) {
 			r.state = parserStateDone
 		}
-		return len(p), nil
+		return n, nil
 	case parserStateDone:
 		return 0, nil
 	default:
@@ -148,9 +162,16 @@ func RequestFromReader(reader io.Reader) (*Request, error) {
 		readIdx -= parsedN
 	}
 
+	req.buffered = buf[:readIdx]
 	return req, nil
 }
 
+// Buffered returns bytes read from the connection past the end of the request, such as the
+// first frames of a protocol the connection is switching to
+func (r *Request) Buffered() []byte {
+	return r.buffered
+}
+
 func parseRequestLine(raw []byte) (*RequestLine, int, error) {
 	eol := bytes.Index(raw, []byte(CRLF))
 	if eol < 0 {
@@ -288,6 +288,18 @@ func TestRequestBodyParse(t *testing.T) {
 	require.NotNil(t, r)
 	assert.Equal(t, "", string(r.Body))
 
+	// Test: Negative content length
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Length: -1\r\n" +
+			"\r\n" +
+			"hello",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	require.Error(t, err)
+
 	// Test: Body shorter than reported content length
 	reader = &chunkReader{
 		data: "POST /submit HTTP/1.1\r\n" +
@@ -300,3 +312,38 @@ func TestRequestBodyParse(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.Error(t, err)
 }
+
+func TestRequestBuffered(t *testing.T) {
+	// Test: Bytes after the headers are kept
+	reader := &chunkReader{
+		data: "GET /ws HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"\r\n" +
+			"\x81\x85frame",
+		numBytesPerRead: 100,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "\x81\x85frame", unread(t, r, reader))
+
+	// Test: Bytes after the body are kept
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Content-Length: 5\r\n" +
+			"\r\n" +
+			"hello" +
+			"GET / HTTP/1.1\r\n",
+		numBytesPerRead: 100,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(r.Body))
+	assert.Equal(t, "GET / HTTP/1.1\r\n", unread(t, r, reader))
+}
+
+// unread joins what the parser buffered past the request with what it never read
+func unread(t *testing.T, r *Request, reader io.Reader) string {
+	rest, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return string(r.Buffered()) + string(rest)
+}
@@ -0,0 +1,155 @@
+package request
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const writeBufferSize = 4096
+
+// Write sends the request in wire format: the request line, Headers in order, and the
+// body. Body is framed with Content-Length. BodyReader is chunked unless Headers has a
+// Content-Length, and so is any body that comes with Trailers; Trailers are declared in a
+// Trailer field if Headers does not have one.
+func (r *Request) Write(w io.Writer) error {
+	bw, ok := w.(*bufio.Writer)
+	if !ok {
+		bw = bufio.NewWriterSize(w, writeBufferSize)
+	}
+
+	r.writeHead(bw)
+	if err := r.writeBody(bw); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// DumpRequest returns the request as Write sends it, for debugging. With body false, only
+// the request line and headers are returned. A BodyReader is read into memory and
+// replaced with a copy, so the request can still be sent afterwards.
+func DumpRequest(r *Request, body bool) ([]byte, error) {
+	var buf bytes.Buffer
+	bw := bufio.NewWriterSize(&buf, writeBufferSize)
+
+	r.writeHead(bw)
+	if body {
+		if r.BodyReader != nil {
+			data, err := io.ReadAll(r.BodyReader)
+			if err != nil {
+				return nil, err
+			}
+			r.BodyReader = bytes.NewReader(data)
+			defer func() { r.BodyReader = bytes.NewReader(data) }()
+		}
+		if err := r.writeBody(bw); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := bw.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (r *Request) chunked() bool {
+	return r.hasTrailers() || (r.BodyReader != nil && r.Headers.Get("Content-Length") == "")
+}
+
+func (r *Request) hasTrailers() bool {
+	return r.Trailers != nil && r.Trailers.Len() > 0
+}
+
+// writeHead writes the request line and the fields, with the ones framing the body
+// replaced by what writeBody is going to send
+func (r *Request) writeHead(bw *bufio.Writer) {
+	version := r.RequestLine.HttpVersion
+	if version == "" {
+		version = "1.1"
+	}
+	fmt.Fprintf(bw, "%s %s HTTP/%s%s", r.RequestLine.Method, r.RequestLine.RequestTarget, version, CRLF)
+
+	chunked := r.chunked()
+	for name, value := range r.Headers.Fields() {
+		switch strings.ToLower(name) {
+		case "transfer-encoding":
+			continue
+		case "content-length":
+			if chunked || r.BodyReader == nil {
+				continue
+			}
+		}
+		fmt.Fprintf(bw, "%s: %s%s", name, value, CRLF)
+	}
+
+	switch {
+	case chunked:
+		if r.hasTrailers() && r.Headers.Get("Trailer") == "" {
+			var names []string
+			for name := range r.Trailers.Fields() {
+				names = append(names, name)
+			}
+			fmt.Fprintf(bw, "Trailer: %s%s", strings.Join(names, ", "), CRLF)
+		}
+		fmt.Fprintf(bw, "Transfer-Encoding: chunked%s", CRLF)
+	case r.BodyReader == nil && (len(r.Body) > 0 || methodHasBody(r.RequestLine.Method)):
+		fmt.Fprintf(bw, "Content-Length: %d%s", len(r.Body), CRLF)
+	}
+	bw.WriteString(CRLF)
+}
+
+func (r *Request) writeBody(bw *bufio.Writer) error {
+	body := r.BodyReader
+	if body == nil {
+		body = bytes.NewReader(r.Body)
+	}
+
+	if !r.chunked() {
+		if r.BodyReader == nil {
+			_, err := io.Copy(bw, body)
+			return err
+		}
+		n, err := strconv.ParseInt(r.Headers.Get("Content-Length"), 10, 64)
+		if err != nil {
+			return fmt.Errorf("malform content-length: %s", err)
+		}
+		if _, err := io.CopyN(bw, body, n); err != nil {
+			return fmt.Errorf("body shorter than content-length: %w", err)
+		}
+		return nil
+	}
+
+	buf := make([]byte, writeBufferSize)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			fmt.Fprintf(bw, "%X%s", n, CRLF)
+			bw.Write(buf[:n])
+			bw.WriteString(CRLF)
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	bw.WriteString("0" + CRLF)
+	if r.Trailers != nil {
+		for name, value := range r.Trailers.Fields() {
+			fmt.Fprintf(bw, "%s: %s%s", name, value, CRLF)
+		}
+	}
+	_, err := bw.WriteString(CRLF)
+	return err
+}
+
+func methodHasBody(method string) bool {
+	return method == "POST" || method == "PUT" || method == "PATCH"
+}
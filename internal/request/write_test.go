@@ -0,0 +1,100 @@
+package request
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Supasiti/prac-go-http-protocol/internal/headers"
+)
+
+func newOutgoing(method, target string, fields ...string) *Request {
+	h := headers.NewHeaders()
+	for i := 0; i+1 < len(fields); i += 2 {
+		h.Set(fields[i], fields[i+1])
+	}
+	return &Request{
+		RequestLine: &RequestLine{Method: method, RequestTarget: target, HttpVersion: "1.1"},
+		Headers:     h,
+	}
+}
+
+func TestRequestWrite(t *testing.T) {
+	// Test: Headers in order and a Content-Length body
+	r := newOutgoing("POST", "/coffee", "Host", "localhost:42069", "content-type", "application/json", "Content-Length", "99")
+	r.Body = []byte(`{"flavor":"dark mode"}`)
+	buf := &bytes.Buffer{}
+	require.NoError(t, r.Write(buf))
+	assert.Equal(t, "POST /coffee HTTP/1.1\r\n"+
+		"Host: localhost:42069\r\n"+
+		"content-type: application/json\r\n"+
+		"Content-Length: 22\r\n"+
+		"\r\n"+
+		`{"flavor":"dark mode"}`, buf.String())
+
+	// Test: Round trip through the parser
+	parsed, err := RequestFromReader(&chunkReader{data: buf.String(), numBytesPerRead: 5})
+	require.NoError(t, err)
+	assert.Equal(t, r.RequestLine, parsed.RequestLine)
+	assert.Equal(t, "application/json", parsed.Headers.Get("Content-Type"))
+	assert.Equal(t, r.Body, parsed.Body)
+
+	// Test: GET without a body has no framing fields
+	buf.Reset()
+	require.NoError(t, newOutgoing("GET", "/", "Host", "example.com").Write(buf))
+	assert.Equal(t, "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n", buf.String())
+
+	// Test: Streamed body is chunked, with declared trailers
+	r = newOutgoing("PUT", "/upload", "Host", "example.com", "Transfer-Encoding", "gzip")
+	r.BodyReader = strings.NewReader("streamed")
+	r.Trailers = headers.NewHeaders()
+	r.Trailers.Set("X-Checksum", "abc")
+	buf.Reset()
+	require.NoError(t, r.Write(buf))
+	assert.Equal(t, "PUT /upload HTTP/1.1\r\n"+
+		"Host: example.com\r\n"+
+		"Trailer: X-Checksum\r\n"+
+		"Transfer-Encoding: chunked\r\n"+
+		"\r\n"+
+		"8\r\nstreamed\r\n"+
+		"0\r\n"+
+		"X-Checksum: abc\r\n"+
+		"\r\n", buf.String())
+
+	// Test: Streamed body with a known length
+	r = newOutgoing("PUT", "/upload", "Content-Length", "4")
+	r.BodyReader = strings.NewReader("data")
+	buf.Reset()
+	require.NoError(t, r.Write(buf))
+	assert.Equal(t, "PUT /upload HTTP/1.1\r\nContent-Length: 4\r\n\r\ndata", buf.String())
+
+	// Test: Streamed body shorter than its Content-Length
+	r = newOutgoing("PUT", "/upload", "Content-Length", "10")
+	r.BodyReader = strings.NewReader("data")
+	require.Error(t, r.Write(io.Discard))
+}
+
+func TestDumpRequest(t *testing.T) {
+	r := newOutgoing("POST", "/submit", "Host", "example.com")
+	r.BodyReader = strings.NewReader("hello")
+
+	// Test: Head only keeps the framing fields
+	dump, err := DumpRequest(r, false)
+	require.NoError(t, err)
+	assert.Equal(t, "POST /submit HTTP/1.1\r\n"+
+		"Host: example.com\r\n"+
+		"Transfer-Encoding: chunked\r\n"+
+		"\r\n", string(dump))
+
+	// Test: With the body, which can still be sent afterwards
+	dump, err = DumpRequest(r, true)
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(string(dump), "\r\n\r\n5\r\nhello\r\n0\r\n\r\n"))
+	buf := &bytes.Buffer{}
+	require.NoError(t, r.Write(buf))
+	assert.Equal(t, string(dump), buf.String())
+}
@@ -0,0 +1,135 @@
+package response
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// DefaultBodyBufferSize is how much of the body Body buffers before giving up on
+// Content-Length and switching to chunked transfer coding
+const DefaultBodyBufferSize = 4096
+
+type bodyWriter struct {
+	w       *Writer
+	buf     []byte
+	size    int // bytes discarded for responses without a body
+	chunked bool
+	direct  bool // headers were written before Body, their framing is kept
+	closed  bool
+}
+
+// Body returns a writer that frames the body automatically. Bodies that fit in the buffer
+// are sent with a Content-Length, larger ones with chunked transfer coding. The status line
+// defaults to 200 if it has not been written, and Header is written on the first flush.
+// When the headers are already out, the body is streamed with the framing they declared,
+// and a declared Content-Length is up to the caller to honour. Close must be called to
+// finish the body, and finishes the response with it.
+func (w *Writer) Body() io.WriteCloser {
+	b := &bodyWriter{w: w}
+	if w.state >= WriterStateBody {
+		b.direct = true
+		b.chunked = w.chunked
+		return b
+	}
+	b.buf = make([]byte, 0, w.bodyBufferSize)
+	return b
+}
+
+// SetBodyBufferSize changes the buffer size used by Body
+func (w *Writer) SetBodyBufferSize(size int) {
+	w.bodyBufferSize = size
+}
+
+func (b *bodyWriter) Write(p []byte) (int, error) {
+	if b.closed {
+		return 0, fmt.Errorf("writing to a closed body")
+	}
+	if b.chunked {
+		return b.writeChunk(p)
+	}
+	if b.direct {
+		return b.w.WriteBody(p)
+	}
+	if !b.w.bodyAllowed() {
+		b.size += len(p)
+		return len(p), nil
+	}
+
+	if len(b.buf)+len(p) <= cap(b.buf) {
+		b.buf = append(b.buf, p...)
+		return len(p), nil
+	}
+
+	// too large for Content-Length, flush what we have as the first chunk
+	b.chunked = true
+	b.w.header.Remove("Content-Length")
+	b.w.header.Set("Transfer-Encoding", "chunked")
+	if err := b.commit(); err != nil {
+		return 0, err
+	}
+	if len(b.buf) > 0 {
+		if _, err := b.w.WriteChunkBody(b.buf); err != nil {
+			return 0, err
+		}
+		b.buf = b.buf[:0]
+	}
+	return b.writeChunk(p)
+}
+
+func (b *bodyWriter) Close() error {
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+
+	if b.chunked || b.direct {
+		return b.w.Close()
+	}
+
+	if !b.w.bodyAllowed() {
+		if statusAllowsBody(b.w.status) {
+			// HEAD gets the Content-Length the GET would have sent
+			b.w.header.Remove("Transfer-Encoding")
+			b.w.header.Set("Content-Length", strconv.Itoa(b.size))
+		}
+		if err := b.commit(); err != nil {
+			return err
+		}
+		return b.w.Close()
+	}
+
+	b.w.header.Remove("Transfer-Encoding")
+	b.w.header.Set("Content-Length", strconv.Itoa(len(b.buf)))
+	if err := b.commit(); err != nil {
+		return err
+	}
+	if _, err := b.w.WriteBody(b.buf); err != nil {
+		return err
+	}
+	return b.w.Close()
+}
+
+func (b *bodyWriter) writeChunk(p []byte) (int, error) {
+	if len(p) == 0 {
+		// an empty chunk would terminate the body
+		return 0, nil
+	}
+	if _, err := b.w.WriteChunkBody(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// commit writes the status line and headers if they have not been written yet
+func (b *bodyWriter) commit() error {
+	if b.w.state == WriterStateStatusLine {
+		if err := b.w.WriteStatusLine(StatusOk); err != nil {
+			return err
+		}
+	}
+	if b.w.state == WriterStateHeaders {
+		return b.w.WriteHeaders(nil)
+	}
+	return fmt.Errorf("headers already written, cannot frame body")
+}
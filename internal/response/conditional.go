@@ -0,0 +1,158 @@
+package response
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Supasiti/prac-go-http-protocol/internal/headers"
+	"github.com/Supasiti/prac-go-http-protocol/internal/request"
+)
+
+// StrongETag derives an entity tag from the content itself, so it changes whenever a
+// single byte does
+func StrongETag(content []byte) string {
+	sum := sha256.Sum256(content)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// WeakETag derives an entity tag from the size and modification time, for content too
+// large to hash on every request
+func WeakETag(size int64, modtime time.Time) string {
+	return fmt.Sprintf(`W/"%x-%x"`, size, modtime.UnixNano())
+}
+
+// EvaluatePreconditions checks the conditional fields of req against the current etag and
+// modtime of the target, in the order of RFC 9110 13.2.2. exists tells whether the target
+// has a current representation at all, which is what "*" matches, whether or not it has an
+// entity tag. It returns StatusNotModified or StatusPreconditionFailed when the request
+// should be answered with that status, and 0 when it should be processed normally. An
+// empty etag or zero modtime disables the checks that depend on it.
+func EvaluatePreconditions(req *request.Request, exists bool, etag string, modtime time.Time) StatusCode {
+	h := req.Headers
+	method := req.RequestLine.Method
+
+	if ifMatch := h.Get("If-Match"); ifMatch != "" {
+		if !matchETags(ifMatch, exists, etag, true) {
+			return StatusPreconditionFailed
+		}
+	} else if t, ok := parseDateField(h, "If-Unmodified-Since", modtime); ok {
+		if modtime.Truncate(time.Second).After(t) {
+			return StatusPreconditionFailed
+		}
+	}
+
+	if ifNoneMatch := h.Get("If-None-Match"); ifNoneMatch != "" {
+		if matchETags(ifNoneMatch, exists, etag, false) {
+			if method == "GET" || method == "HEAD" {
+				return StatusNotModified
+			}
+			return StatusPreconditionFailed
+		}
+	} else if t, ok := parseDateField(h, "If-Modified-Since", modtime); ok && (method == "GET" || method == "HEAD") {
+		if !modtime.Truncate(time.Second).After(t) {
+			return StatusNotModified
+		}
+	}
+
+	return 0
+}
+
+// CheckPreconditions evaluates the conditional fields of req against the ETag set on
+// Header and modtime, for a handler about to send a current representation. When the request fails them, the 304 or 412 response is written and
+// true is returned; the handler has nothing left to do.
+func CheckPreconditions(w *Writer, req *request.Request, modtime time.Time) (bool, error) {
+	status := EvaluatePreconditions(req, true, w.Header().Get("ETag"), modtime)
+	if status == 0 {
+		return false, nil
+	}
+
+	h := w.Header()
+	h.Remove("Content-Type")
+	h.Remove("Content-Range")
+	h.Remove("Transfer-Encoding")
+	if status == StatusNotModified {
+		// keep the validators so the client can refresh its stored copy
+		h.Remove("Content-Length")
+		if !modtime.IsZero() && h.Get("Last-Modified") == "" {
+			h.Set("Last-Modified", headers.FormatTime(modtime))
+		}
+	} else {
+		h.Set("Content-Length", "0")
+	}
+	return true, w.WriteHeader(status)
+}
+
+// parseDateField returns the date in the named field. Invalid dates and targets without a
+// modification time are ignored, as RFC 9110 asks.
+func parseDateField(h *headers.Headers, name string, modtime time.Time) (time.Time, bool) {
+	v := h.Get(name)
+	if v == "" || modtime.IsZero() {
+		return time.Time{}, false
+	}
+	t, err := headers.ParseTime(v)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// matchETags reports whether etag is in the list of entity tags in field, using strong or
+// weak comparison (RFC 9110 8.8.3.2). "*" matches whenever a current representation
+// exists, even one without an entity tag (RFC 9110 13.1.1, 13.1.2).
+func matchETags(field string, exists bool, etag string, strong bool) bool {
+	if strings.TrimSpace(field) == "*" {
+		return exists
+	}
+	if etag == "" {
+		return false
+	}
+
+	for _, tag := range parseETags(field) {
+		if strong {
+			if !isWeak(tag) && !isWeak(etag) && tag == etag {
+				return true
+			}
+			continue
+		}
+		if strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// parseETags splits a list of entity tags. Commas are allowed inside the quotes, so the
+// list cannot simply be split on them.
+func parseETags(field string) []string {
+	var tags []string
+	s := field
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if s == "" {
+			return tags
+		}
+
+		prefix := ""
+		if strings.HasPrefix(s, "W/") {
+			prefix, s = "W/", s[2:]
+		}
+		if !strings.HasPrefix(s, `"`) {
+			// not an entity tag, skip to the next element
+			_, s, _ = strings.Cut(s, ",")
+			continue
+		}
+		end := strings.IndexByte(s[1:], '"')
+		if end < 0 {
+			return tags
+		}
+		tags = append(tags, prefix+s[:end+2])
+		s = s[end+2:]
+	}
+}
+
+func isWeak(etag string) bool {
+	return strings.HasPrefix(etag, "W/")
+}
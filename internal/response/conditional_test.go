@@ -0,0 +1,137 @@
+package response
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Supasiti/prac-go-http-protocol/internal/headers"
+	"github.com/Supasiti/prac-go-http-protocol/internal/request"
+)
+
+func newConditionalRequest(method string, fields ...string) *request.Request {
+	h := headers.NewHeaders()
+	for i := 0; i+1 < len(fields); i += 2 {
+		h.Set(fields[i], fields[i+1])
+	}
+	return &request.Request{
+		RequestLine: &request.RequestLine{Method: method, RequestTarget: "/", HttpVersion: "1.1"},
+		Headers:     h,
+	}
+}
+
+func TestETags(t *testing.T) {
+	// Test: Strong tags follow the content
+	assert.Equal(t, StrongETag([]byte("hello")), StrongETag([]byte("hello")))
+	assert.NotEqual(t, StrongETag([]byte("hello")), StrongETag([]byte("hellO")))
+	assert.True(t, strings.HasPrefix(StrongETag(nil), `"`))
+
+	// Test: Weak tags follow size and modification time
+	modtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	assert.Equal(t, WeakETag(10, modtime), WeakETag(10, modtime))
+	assert.NotEqual(t, WeakETag(10, modtime), WeakETag(10, modtime.Add(time.Second)))
+	assert.True(t, strings.HasPrefix(WeakETag(10, modtime), `W/"`))
+
+	// Test: Lists with commas inside tags
+	assert.Equal(t, []string{`"a,b"`, `W/"c"`, `"d"`}, parseETags(` "a,b", W/"c",,"d"`))
+
+	// Test: Strong comparison never matches weak tags
+	assert.True(t, matchETags(`"x", "v1"`, true, `"v1"`, true))
+	assert.False(t, matchETags(`W/"v1"`, true, `"v1"`, true))
+	assert.True(t, matchETags(`W/"v1"`, true, `"v1"`, false))
+
+	// Test: "*" depends on the representation existing, not on it having a tag
+	assert.True(t, matchETags("*", true, `"v1"`, true))
+	assert.True(t, matchETags("*", true, "", true))
+	assert.False(t, matchETags("*", false, "", true))
+}
+
+func TestEvaluatePreconditions(t *testing.T) {
+	etag := `"v1"`
+	modtime := time.Date(2024, 1, 2, 3, 4, 5, 500, time.UTC)
+	same := "Tue, 02 Jan 2024 03:04:05 GMT"
+	earlier := "Mon, 01 Jan 2024 00:00:00 GMT"
+
+	cases := []struct {
+		name   string
+		req    *request.Request
+		status StatusCode
+	}{
+		{"no conditions", newConditionalRequest("GET"), 0},
+		{"if-none-match hit", newConditionalRequest("GET", "If-None-Match", `W/"v1"`), StatusNotModified},
+		{"if-none-match miss", newConditionalRequest("GET", "If-None-Match", `"v0"`), 0},
+		{"if-none-match on unsafe method", newConditionalRequest("PUT", "If-None-Match", "*"), StatusPreconditionFailed},
+		{"if-match hit", newConditionalRequest("PUT", "If-Match", `"v1"`), 0},
+		{"if-match weak", newConditionalRequest("PUT", "If-Match", `W/"v1"`), StatusPreconditionFailed},
+		{"if-modified-since unchanged", newConditionalRequest("GET", "If-Modified-Since", same), StatusNotModified},
+		{"if-modified-since changed", newConditionalRequest("GET", "If-Modified-Since", earlier), 0},
+		{"if-modified-since on post", newConditionalRequest("POST", "If-Modified-Since", same), 0},
+		{"if-modified-since invalid", newConditionalRequest("GET", "If-Modified-Since", "soon"), 0},
+		{"if-unmodified-since changed", newConditionalRequest("PUT", "If-Unmodified-Since", earlier), StatusPreconditionFailed},
+		{"if-unmodified-since unchanged", newConditionalRequest("PUT", "If-Unmodified-Since", same), 0},
+		// If-None-Match takes precedence over If-Modified-Since
+		{"if-none-match miss beats date", newConditionalRequest("GET", "If-None-Match", `"v0"`, "If-Modified-Since", same), 0},
+		// If-Match takes precedence over If-Unmodified-Since
+		{"if-match hit beats date", newConditionalRequest("PUT", "If-Match", `"v1"`, "If-Unmodified-Since", earlier), 0},
+	}
+	for _, c := range cases {
+		// Test: Each conditional field
+		assert.Equal(t, c.status, EvaluatePreconditions(c.req, true, etag, modtime), c.name)
+	}
+
+	// Test: "*" follows whether the target exists, with or without an entity tag
+	assert.Equal(t, StatusCode(0), EvaluatePreconditions(newConditionalRequest("PUT", "If-Match", "*"), true, "", time.Time{}))
+	assert.Equal(t, StatusPreconditionFailed, EvaluatePreconditions(newConditionalRequest("PUT", "If-Match", "*"), false, "", time.Time{}))
+	assert.Equal(t, StatusPreconditionFailed, EvaluatePreconditions(newConditionalRequest("PUT", "If-None-Match", "*"), true, "", time.Time{}))
+	assert.Equal(t, StatusCode(0), EvaluatePreconditions(newConditionalRequest("PUT", "If-None-Match", "*"), false, "", time.Time{}))
+}
+
+func TestCheckPreconditions(t *testing.T) {
+	// Test: 304 keeps the validators and drops the content fields
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.Header().Set("ETag", `"v1"`)
+	w.Header().Set("Content-Type", "text/html")
+	w.Header().Set("Content-Length", "42")
+	done, err := CheckPreconditions(w, newConditionalRequest("GET", "If-None-Match", `"v1"`), time.Time{})
+	require.NoError(t, err)
+	assert.True(t, done)
+	assert.Equal(t, "HTTP/1.1 304 Not Modified\r\n"+
+		"Etag: \"v1\"\r\n"+
+		"\r\n", flushed(t, w, buf))
+
+	// Test: 412 has an empty body
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.Header().Set("ETag", `"v1"`)
+	done, err = CheckPreconditions(w, newConditionalRequest("PUT", "If-Match", `"v0"`), time.Time{})
+	require.NoError(t, err)
+	assert.True(t, done)
+	assert.Equal(t, "HTTP/1.1 412 Precondition Failed\r\n"+
+		"Etag: \"v1\"\r\n"+
+		"Content-Length: 0\r\n"+
+		"\r\n", flushed(t, w, buf))
+
+	// Test: Nothing is written when the request passes
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	done, err = CheckPreconditions(w, newConditionalRequest("GET"), time.Time{})
+	require.NoError(t, err)
+	assert.False(t, done)
+	assert.Equal(t, "", flushed(t, w, buf))
+
+	// Test: ServeContent answers 304 for an unchanged file
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	modtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	req := newConditionalRequest("GET", "If-Modified-Since", "Tue, 02 Jan 2024 03:04:05 GMT", "Range", "bytes=0-1")
+	require.NoError(t, ServeContent(w, req, modtime, strings.NewReader("content")))
+	assert.Equal(t, "HTTP/1.1 304 Not Modified\r\n"+
+		"Accept-Ranges: bytes\r\n"+
+		"Last-Modified: Tue, 02 Jan 2024 03:04:05 GMT\r\n"+
+		"\r\n", flushed(t, w, buf))
+}
@@ -0,0 +1,73 @@
+package response
+
+import (
+	"bufio"
+	"io"
+)
+
+const encoderBufferSize = 4096
+
+// bodyEncoder feeds body bytes through an encoder whose output is buffered and written as
+// chunks, so many small encoder writes end up in few chunks
+type bodyEncoder struct {
+	enc io.WriteCloser
+	buf *bufio.Writer
+}
+
+func (e *bodyEncoder) Write(p []byte) (int, error) {
+	return e.enc.Write(p)
+}
+
+// Flush pushes data held by the encoder and the chunk buffer out as a chunk, if the
+// encoder supports flushing
+func (e *bodyEncoder) Flush() error {
+	if f, ok := e.enc.(interface{ Flush() error }); ok {
+		if err := f.Flush(); err != nil {
+			return err
+		}
+	}
+	return e.buf.Flush()
+}
+
+func (e *bodyEncoder) Close() error {
+	if err := e.enc.Close(); err != nil {
+		return err
+	}
+	return e.buf.Flush()
+}
+
+type chunkWriter struct {
+	w *Writer
+}
+
+func (c chunkWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if _, err := c.w.writeChunk(p, ""); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// BeforeWriteHeaders registers fn to run right before the headers of the final response
+// are written, after the fields given to WriteHeaders have been merged into Header.
+func (w *Writer) BeforeWriteHeaders(fn func(w *Writer)) {
+	w.beforeHeaders = append(w.beforeHeaders, fn)
+}
+
+// SetBodyEncoder routes the body through an encoder such as a compressor. newEncoder is
+// given the writer the encoded bytes go to. The response switches to chunked transfer
+// coding, since the encoded length is not known up front. It must be called before the
+// headers are written, typically from BeforeWriteHeaders.
+func (w *Writer) SetBodyEncoder(newEncoder func(dst io.Writer) io.WriteCloser) {
+	if w.state != WriterStateStatusLine && w.state != WriterStateHeaders {
+		return
+	}
+
+	w.header.Remove("Content-Length")
+	w.header.Set("Transfer-Encoding", "chunked")
+
+	buf := bufio.NewWriterSize(chunkWriter{w: w}, encoderBufferSize)
+	w.encoder = &bodyEncoder{enc: newEncoder(buf), buf: buf}
+}
@@ -0,0 +1,49 @@
+package response
+
+import (
+	"errors"
+	"net"
+)
+
+var (
+	ErrNotHijackable = errors.New("connection cannot be hijacked")
+	ErrHijacked      = errors.New("connection has been hijacked")
+)
+
+// Hijacker hands over the underlying connection together with any bytes read from it that
+// have not been consumed as part of the request
+type Hijacker func() (net.Conn, []byte, error)
+
+// SetHijacker makes the connection behind the writer available to Hijack. The server sets
+// it for every request.
+func (w *Writer) SetHijacker(h Hijacker) {
+	w.hijacker = h
+}
+
+// Hijack takes over the connection. Anything already written is flushed first; afterwards
+// the writer refuses further writes and the caller is responsible for closing the
+// connection.
+func (w *Writer) Hijack() (net.Conn, []byte, error) {
+	if w.hijacked {
+		return nil, nil, ErrHijacked
+	}
+	if w.hijacker == nil {
+		return nil, nil, ErrNotHijackable
+	}
+	if err := w.writer.Flush(); err != nil {
+		return nil, nil, err
+	}
+
+	conn, buffered, err := w.hijacker()
+	if err != nil {
+		return nil, nil, err
+	}
+	w.hijacked = true
+	w.state = WriterStateDone
+	return conn, buffered, nil
+}
+
+// Hijacked reports whether a handler has taken over the connection
+func (w *Writer) Hijacked() bool {
+	return w.hijacked
+}
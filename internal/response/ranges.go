@@ -0,0 +1,226 @@
+package response
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Supasiti/prac-go-http-protocol/internal/headers"
+	"github.com/Supasiti/prac-go-http-protocol/internal/request"
+)
+
+var (
+	ErrInvalidRange        = errors.New("invalid range")
+	ErrRangeNotSatisfiable = errors.New("range not satisfiable")
+)
+
+// ByteRange is a satisfiable part of a representation
+type ByteRange struct {
+	Start  int64
+	Length int64
+}
+
+// ContentRange formats the range for the Content-Range field
+func (r ByteRange) ContentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.Start, r.Start+r.Length-1, size)
+}
+
+// ParseRange parses a Range field for a representation of size bytes (RFC 9110 14.1.2).
+// Ranges past the end are trimmed and unsatisfiable ones dropped. ErrInvalidRange means
+// the field should be ignored, ErrRangeNotSatisfiable that none of the ranges overlap the
+// representation.
+func ParseRange(s string, size int64) ([]ByteRange, error) {
+	unit, set, ok := strings.Cut(s, "=")
+	if !ok || !strings.EqualFold(strings.TrimSpace(unit), "bytes") {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidRange, s)
+	}
+
+	var ranges []ByteRange
+	for spec := range strings.SplitSeq(set, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		first, last, ok := strings.Cut(spec, "-")
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidRange, spec)
+		}
+
+		var r ByteRange
+		if first == "" {
+			// suffix range, the last n bytes
+			n, err := parseRangePos(last)
+			if err != nil {
+				return nil, err
+			}
+			if n == 0 || size == 0 {
+				continue
+			}
+			n = min(n, size)
+			r = ByteRange{Start: size - n, Length: n}
+		} else {
+			start, err := parseRangePos(first)
+			if err != nil {
+				return nil, err
+			}
+			end := size - 1
+			if last != "" {
+				if end, err = parseRangePos(last); err != nil {
+					return nil, err
+				}
+				if end < start {
+					return nil, fmt.Errorf("%w: %q", ErrInvalidRange, spec)
+				}
+			}
+			if start >= size {
+				continue
+			}
+			end = min(end, size-1)
+			r = ByteRange{Start: start, Length: end - start + 1}
+		}
+		ranges = append(ranges, r)
+	}
+
+	if len(ranges) == 0 {
+		if strings.TrimSpace(set) == "" {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidRange, s)
+		}
+		return nil, ErrRangeNotSatisfiable
+	}
+	return ranges, nil
+}
+
+func parseRangePos(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || strings.TrimLeft(s, "0123456789") != "" {
+		return 0, fmt.Errorf("%w: bad position %q", ErrInvalidRange, s)
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidRange, err)
+	}
+	return n, nil
+}
+
+// ServeContent writes content as the response to req, honouring the conditional fields,
+// Range and If-Range. Content-Type and ETag should be set on Header beforehand; modtime is
+// sent as Last-Modified unless it is zero. Only GET requests get partial responses.
+func ServeContent(w *Writer, req *request.Request, modtime time.Time, content io.ReadSeeker) error {
+	size, err := content.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	h := w.Header()
+	h.Set("Accept-Ranges", "bytes")
+	if !modtime.IsZero() {
+		h.Set("Last-Modified", headers.FormatTime(modtime))
+	}
+	if done, err := CheckPreconditions(w, req, modtime); done {
+		return err
+	}
+
+	var ranges []ByteRange
+	if rangeHeader := req.Headers.Get("Range"); rangeHeader != "" && req.RequestLine.Method == "GET" &&
+		ifRangeMatches(req, h, modtime) {
+		ranges, err = ParseRange(rangeHeader, size)
+		switch {
+		case errors.Is(err, ErrRangeNotSatisfiable):
+			h.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			h.Set("Content-Length", "0")
+			return w.WriteHeader(StatusRangeNotSatisfiable)
+		case err != nil:
+			// a malformed Range is ignored and the whole representation sent
+			ranges = nil
+		case sumLengths(ranges) > size:
+			// overlapping ranges would cost more than the whole thing
+			ranges = nil
+		}
+	}
+
+	switch len(ranges) {
+	case 0:
+		return sendSection(w, StatusOk, content, 0, size)
+	case 1:
+		h.Set("Content-Range", ranges[0].ContentRange(size))
+		return sendSection(w, StatusPartialContent, content, ranges[0].Start, ranges[0].Length)
+	default:
+		return sendMultipart(w, content, ranges, size)
+	}
+}
+
+// ifRangeMatches reports whether the Range field applies. If-Range holds either a strong
+// entity tag or the Last-Modified date the client has a partial copy of.
+func ifRangeMatches(req *request.Request, h *headers.Headers, modtime time.Time) bool {
+	ifRange := req.Headers.Get("If-Range")
+	if ifRange == "" {
+		return true
+	}
+	if strings.HasPrefix(ifRange, `"`) || isWeak(ifRange) {
+		return matchETags(ifRange, true, h.Get("ETag"), true)
+	}
+	t, err := headers.ParseTime(ifRange)
+	return err == nil && !modtime.IsZero() && t.Equal(modtime.Truncate(time.Second))
+}
+
+func sumLengths(ranges []ByteRange) int64 {
+	var n int64
+	for _, r := range ranges {
+		n += r.Length
+	}
+	return n
+}
+
+func sendSection(w *Writer, status StatusCode, content io.ReadSeeker, start, length int64) error {
+	if _, err := content.Seek(start, io.SeekStart); err != nil {
+		return err
+	}
+	w.Header().Remove("Transfer-Encoding")
+	w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+	if err := w.WriteHeader(status); err != nil {
+		return err
+	}
+	_, err := io.CopyN(w, content, length)
+	return err
+}
+
+// sendMultipart sends each range as a part of a multipart/byteranges body (RFC 9110 14.6)
+func sendMultipart(w *Writer, content io.ReadSeeker, ranges []ByteRange, size int64) error {
+	h := w.Header()
+	contentType := h.Get("Content-Type")
+	h.Remove("Content-Length")
+
+	if err := w.WriteStatusLine(StatusPartialContent); err != nil {
+		return err
+	}
+	body := w.Body()
+	mw := multipart.NewWriter(body)
+	h.Set("Content-Type", "multipart/byteranges; boundary="+mw.Boundary())
+
+	for _, r := range ranges {
+		part := textproto.MIMEHeader{}
+		if contentType != "" {
+			part.Set("Content-Type", contentType)
+		}
+		part.Set("Content-Range", r.ContentRange(size))
+		pw, err := mw.CreatePart(part)
+		if err != nil {
+			return err
+		}
+		if _, err := content.Seek(r.Start, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(pw, content, r.Length); err != nil {
+			return err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return err
+	}
+	return body.Close()
+}
@@ -0,0 +1,144 @@
+package response
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Supasiti/prac-go-http-protocol/internal/headers"
+	"github.com/Supasiti/prac-go-http-protocol/internal/request"
+)
+
+func TestParseRange(t *testing.T) {
+	// Test: First, last and suffix ranges
+	ranges, err := ParseRange("bytes=0-4, 10-, -3", 20)
+	require.NoError(t, err)
+	assert.Equal(t, []ByteRange{{0, 5}, {10, 10}, {17, 3}}, ranges)
+
+	// Test: Ranges past the end are trimmed, unsatisfiable ones dropped
+	ranges, err = ParseRange("bytes=15-100,30-40,-50", 20)
+	require.NoError(t, err)
+	assert.Equal(t, []ByteRange{{15, 5}, {0, 20}}, ranges)
+
+	// Test: Nothing satisfiable
+	_, err = ParseRange("bytes=20-", 20)
+	require.ErrorIs(t, err, ErrRangeNotSatisfiable)
+
+	// Test: Malformed ranges
+	for _, s := range []string{"items=0-1", "bytes=", "bytes=5-1", "bytes=a-b", "bytes=1", "bytes=-+1"} {
+		_, err = ParseRange(s, 20)
+		require.ErrorIs(t, err, ErrInvalidRange, s)
+	}
+
+	// Test: Content-Range
+	assert.Equal(t, "bytes 10-19/20", ByteRange{10, 10}.ContentRange(20))
+}
+
+func newRangeRequest(method, rangeHeader, ifRange string) *request.Request {
+	h := headers.NewHeaders()
+	if rangeHeader != "" {
+		h.Set("Range", rangeHeader)
+	}
+	if ifRange != "" {
+		h.Set("If-Range", ifRange)
+	}
+	return &request.Request{
+		RequestLine: &request.RequestLine{Method: method, RequestTarget: "/video", HttpVersion: "1.1"},
+		Headers:     h,
+	}
+}
+
+func TestServeContent(t *testing.T) {
+	content := strings.NewReader("0123456789abcdefghij")
+	modtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	// Test: No range sends everything
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	require.NoError(t, ServeContent(w, newRangeRequest("GET", "", ""), modtime, content))
+	require.NoError(t, w.Close())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Accept-Ranges: bytes\r\n"+
+		"Last-Modified: Tue, 02 Jan 2024 03:04:05 GMT\r\n"+
+		"Content-Length: 20\r\n"+
+		"\r\n"+
+		"0123456789abcdefghij", buf.String())
+
+	// Test: Single range
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	require.NoError(t, ServeContent(w, newRangeRequest("GET", "bytes=5-9", ""), time.Time{}, content))
+	require.NoError(t, w.Close())
+	assert.Equal(t, "HTTP/1.1 206 Partial Content\r\n"+
+		"Accept-Ranges: bytes\r\n"+
+		"Content-Range: bytes 5-9/20\r\n"+
+		"Content-Length: 5\r\n"+
+		"\r\n"+
+		"56789", buf.String())
+
+	// Test: Multiple ranges
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.Header().Set("Content-Type", "text/plain")
+	require.NoError(t, ServeContent(w, newRangeRequest("GET", "bytes=0-1,-2", ""), time.Time{}, content))
+	out := buf.String()
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 206 Partial Content\r\n"))
+	assert.Contains(t, out, "Content-Type: multipart/byteranges; boundary=")
+	assert.Contains(t, out, "Content-Range: bytes 0-1/20\r\nContent-Type: text/plain\r\n\r\n01\r\n")
+	assert.Contains(t, out, "Content-Range: bytes 18-19/20\r\nContent-Type: text/plain\r\n\r\nij\r\n")
+
+	// Test: Unsatisfiable range
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	require.NoError(t, ServeContent(w, newRangeRequest("GET", "bytes=30-", ""), time.Time{}, content))
+	require.NoError(t, w.Close())
+	assert.Equal(t, "HTTP/1.1 416 Range Not Satisfiable\r\n"+
+		"Accept-Ranges: bytes\r\n"+
+		"Content-Range: bytes */20\r\n"+
+		"Content-Length: 0\r\n"+
+		"\r\n", buf.String())
+
+	// Test: Malformed range and HEAD get the whole representation
+	for _, req := range []*request.Request{
+		newRangeRequest("GET", "bytes=x", ""),
+		newRangeRequest("HEAD", "bytes=0-1", ""),
+	} {
+		buf = &bytes.Buffer{}
+		w = NewWriter(buf)
+		w.SetRequestMethod(req.RequestLine.Method)
+		require.NoError(t, ServeContent(w, req, time.Time{}, content))
+		require.NoError(t, w.Close())
+		assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 200 OK\r\n"))
+		assert.Contains(t, buf.String(), "Content-Length: 20\r\n")
+	}
+
+	// Test: If-Range with the current date applies the range, a stale one does not
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	req := newRangeRequest("GET", "bytes=0-0", "Tue, 02 Jan 2024 03:04:05 GMT")
+	require.NoError(t, ServeContent(w, req, modtime.Add(time.Millisecond), content))
+	assert.True(t, strings.HasPrefix(flushed(t, w, buf), "HTTP/1.1 206 Partial Content\r\n"))
+
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	req = newRangeRequest("GET", "bytes=0-0", "Mon, 01 Jan 2024 00:00:00 GMT")
+	require.NoError(t, ServeContent(w, req, modtime, content))
+	assert.True(t, strings.HasPrefix(flushed(t, w, buf), "HTTP/1.1 200 OK\r\n"))
+
+	// Test: If-Range with entity tags needs a strong match
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.Header().Set("ETag", `"v1"`)
+	require.NoError(t, ServeContent(w, newRangeRequest("GET", "bytes=0-0", `"v1"`), time.Time{}, content))
+	assert.True(t, strings.HasPrefix(flushed(t, w, buf), "HTTP/1.1 206 Partial Content\r\n"))
+
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.Header().Set("ETag", `W/"v1"`)
+	require.NoError(t, ServeContent(w, newRangeRequest("GET", "bytes=0-0", `W/"v1"`), time.Time{}, content))
+	assert.True(t, strings.HasPrefix(flushed(t, w, buf), "HTTP/1.1 200 OK\r\n"))
+}
@@ -0,0 +1,267 @@
+package response
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/Supasiti/prac-go-http-protocol/internal/headers"
+)
+
+// maxLineLength bounds the status line, field lines and chunk-size lines of a response,
+// unless the caller brings its own bufio.Reader
+const maxLineLength = 8192
+
+var ErrLineTooLong = errors.New("response line too long")
+
+type StatusLine struct {
+	HttpVersion  string
+	StatusCode   StatusCode
+	ReasonPhrase string
+}
+
+// Response is a response read by a client. Body is read from the connection as it is
+// consumed; Trailers is filled in once a chunked Body has been read to the end. Closing
+// Body does nothing here, clients wrap it to release the connection.
+type Response struct {
+	StatusLine *StatusLine
+	Headers    *headers.Headers
+	Trailers   *headers.Headers
+	Body       io.ReadCloser
+
+	// Interim holds the 1xx responses that came before the final one
+	Interim []*StatusLine
+}
+
+// ResponseFromReader reads the response to a request made with method. Interim 1xx
+// responses are skipped, except 101 which ends the exchange. The body is framed by
+// Transfer-Encoding, Content-Length or the connection closing (RFC 9112 6.3).
+//
+// Pass a *bufio.Reader to keep reading further responses from the same connection, as the
+// body reader leaves any bytes past the response in it. Its size then limits line length.
+func ResponseFromReader(reader io.Reader, method string) (*Response, error) {
+	br, ok := reader.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReaderSize(reader, maxLineLength)
+	}
+
+	res := &Response{Trailers: headers.NewHeaders()}
+	for {
+		statusLine, err := readStatusLine(br)
+		if err != nil {
+			return nil, err
+		}
+		h := headers.NewHeaders()
+		if err := readFields(br, h); err != nil {
+			return nil, err
+		}
+
+		code := statusLine.StatusCode
+		if code.IsInformational() && code != StatusSwitchingProtocols {
+			res.Interim = append(res.Interim, statusLine)
+			continue
+		}
+		res.StatusLine = statusLine
+		res.Headers = h
+		break
+	}
+
+	body, err := res.bodyReader(br, method)
+	if err != nil {
+		return nil, err
+	}
+	res.Body = body
+	return res, nil
+}
+
+func (r *Response) bodyReader(br *bufio.Reader, method string) (io.ReadCloser, error) {
+	code := r.StatusLine.StatusCode
+	// a 2xx to CONNECT turns the connection into a tunnel
+	tunnel := method == "CONNECT" && code.IsSuccess()
+	if method == "HEAD" || !statusAllowsBody(code) || code == StatusSwitchingProtocols || tunnel {
+		return io.NopCloser(bytes.NewReader(nil)), nil
+	}
+
+	if te := r.Headers.Get("Transfer-Encoding"); te != "" {
+		if isChunked(r.Headers) {
+			return io.NopCloser(&chunkedReader{r: br, trailers: r.Trailers}), nil
+		}
+		// any other final coding runs until the connection closes
+		return io.NopCloser(br), nil
+	}
+
+	if cl := r.Headers.Get("Content-Length"); cl != "" {
+		n, err := strconv.ParseInt(strings.TrimSpace(cl), 10, 64)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("malform content-length: %s", cl)
+		}
+		return io.NopCloser(&lengthReader{r: br, remaining: n}), nil
+	}
+	return io.NopCloser(br), nil
+}
+
+func readStatusLine(br *bufio.Reader) (*StatusLine, error) {
+	line, err := readLine(br)
+	if err != nil {
+		return nil, err
+	}
+
+	version, rest, ok := strings.Cut(line, " ")
+	if !ok {
+		return nil, fmt.Errorf("malform status line: %s", line)
+	}
+	httpVersion, ok := strings.CutPrefix(version, "HTTP/")
+	if !ok || (httpVersion != "1.1" && httpVersion != "1.0") {
+		return nil, fmt.Errorf("unsupported HTTP version: %s", version)
+	}
+
+	codeStr, reason, _ := strings.Cut(rest, " ")
+	code, err := strconv.Atoi(codeStr)
+	if len(codeStr) != 3 || err != nil || !StatusCode(code).valid() {
+		return nil, fmt.Errorf("malform status code: %s", codeStr)
+	}
+	if !validReasonPhrase(reason) {
+		return nil, fmt.Errorf("invalid reason phrase: %q", reason)
+	}
+
+	return &StatusLine{
+		HttpVersion:  httpVersion,
+		StatusCode:   StatusCode(code),
+		ReasonPhrase: reason,
+	}, nil
+}
+
+// readFields reads field lines into h up to the empty line ending the section
+func readFields(br *bufio.Reader, h *headers.Headers) error {
+	for {
+		line, err := readLine(br)
+		if err != nil {
+			return err
+		}
+		_, done, err := h.Parse([]byte(line + headers.CRLF))
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+	}
+}
+
+// readLine returns the next line without its line ending. A bare LF is accepted as the
+// end of a line, as RFC 9112 2.2 allows.
+func readLine(br *bufio.Reader) (string, error) {
+	line, err := br.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return "", ErrLineTooLong
+	}
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return "", io.ErrUnexpectedEOF
+		}
+		return "", err
+	}
+	line = bytes.TrimSuffix(line[:len(line)-1], []byte("\r"))
+	return string(line), nil
+}
+
+// lengthReader reads a body of a known length, failing if the connection ends early
+type lengthReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *lengthReader) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if errors.Is(err, io.EOF) && l.remaining > 0 {
+		return n, io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// chunkedReader decodes chunked transfer coding (RFC 9112 7.1). Chunk extensions are
+// ignored and the trailer section is read into trailers.
+type chunkedReader struct {
+	r         *bufio.Reader
+	trailers  *headers.Headers
+	remaining int64
+	done      bool
+	err       error
+}
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	if c.done {
+		return 0, io.EOF
+	}
+
+	if c.remaining == 0 {
+		size, err := c.readChunkSize()
+		if err != nil {
+			c.err = err
+			return 0, err
+		}
+		if size == 0 {
+			if err := readFields(c.r, c.trailers); err != nil {
+				c.err = err
+				return 0, err
+			}
+			c.done = true
+			return 0, io.EOF
+		}
+		c.remaining = size
+	}
+
+	if int64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, err := c.r.Read(p)
+	c.remaining -= int64(n)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		c.err = err
+		return n, err
+	}
+
+	if c.remaining == 0 {
+		// data is followed by CRLF
+		line, err := readLine(c.r)
+		if err == nil && line != "" {
+			err = fmt.Errorf("missing CRLF after chunk data")
+		}
+		if err != nil {
+			c.err = err
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (c *chunkedReader) readChunkSize() (int64, error) {
+	line, err := readLine(c.r)
+	if err != nil {
+		return 0, err
+	}
+	sizeStr, _, _ := strings.Cut(line, ";")
+	sizeStr = strings.TrimSpace(sizeStr)
+	size, err := strconv.ParseInt(sizeStr, 16, 64)
+	if err != nil || size < 0 || sizeStr == "" || strings.HasPrefix(sizeStr, "+") {
+		return 0, fmt.Errorf("malform chunk size: %s", line)
+	}
+	return size, nil
+}
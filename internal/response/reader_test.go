@@ -0,0 +1,146 @@
+package response
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readAll(t *testing.T, raw, method string) (*Response, string) {
+	res, err := ResponseFromReader(strings.NewReader(raw), method)
+	require.NoError(t, err)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	return res, string(body)
+}
+
+func TestResponseFromReader(t *testing.T) {
+	// Test: Content-Length body
+	res, body := readAll(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"Content-Length: 5\r\n"+
+		"\r\n"+
+		"hello", "GET")
+	assert.Equal(t, "1.1", res.StatusLine.HttpVersion)
+	assert.Equal(t, StatusOk, res.StatusLine.StatusCode)
+	assert.Equal(t, "OK", res.StatusLine.ReasonPhrase)
+	assert.Equal(t, "text/plain", res.Headers.Get("content-type"))
+	assert.Equal(t, "hello", body)
+
+	// Test: Chunked body with extensions and trailers
+	res, body = readAll(t, "HTTP/1.1 200 OK\r\n"+
+		"Transfer-Encoding: chunked\r\n"+
+		"Trailer: X-Checksum\r\n"+
+		"\r\n"+
+		"5;name=value\r\nhello\r\n"+
+		"7\r\n, world\r\n"+
+		"0\r\n"+
+		"X-Checksum: abc\r\n"+
+		"\r\n", "GET")
+	assert.Equal(t, "hello, world", body)
+	assert.Equal(t, "abc", res.Trailers.Get("X-Checksum"))
+
+	// Test: Close-delimited body
+	res, body = readAll(t, "HTTP/1.0 200 OK\r\n"+
+		"\r\n"+
+		"until the end", "GET")
+	assert.Equal(t, "1.0", res.StatusLine.HttpVersion)
+	assert.Equal(t, "until the end", body)
+
+	// Test: Interim responses are skipped
+	res, body = readAll(t, "HTTP/1.1 100 Continue\r\n"+
+		"\r\n"+
+		"HTTP/1.1 103 Early Hints\r\n"+
+		"Link: </style.css>; rel=preload\r\n"+
+		"\r\n"+
+		"HTTP/1.1 201 Created\r\n"+
+		"Content-Length: 2\r\n"+
+		"\r\n"+
+		"ok", "POST")
+	assert.Equal(t, StatusCreated, res.StatusLine.StatusCode)
+	require.Len(t, res.Interim, 2)
+	assert.Equal(t, StatusContinue, res.Interim[0].StatusCode)
+	assert.Equal(t, StatusEarlyHints, res.Interim[1].StatusCode)
+	assert.Equal(t, "ok", body)
+
+	// Test: No body for HEAD, 204 and 304 whatever the headers say
+	for _, c := range []struct{ raw, method string }{
+		{"HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\n", "HEAD"},
+		{"HTTP/1.1 204 No Content\r\n\r\n", "DELETE"},
+		{"HTTP/1.1 304 Not Modified\r\nContent-Length: 5\r\n\r\n", "GET"},
+	} {
+		_, body = readAll(t, c.raw, c.method)
+		assert.Equal(t, "", body, c.raw)
+	}
+
+	// Test: 101 leaves the rest of the stream to the new protocol
+	br := bufio.NewReader(strings.NewReader("HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"\r\n" +
+		"\x81\x02hi"))
+	res, err := ResponseFromReader(br, "GET")
+	require.NoError(t, err)
+	assert.Equal(t, StatusSwitchingProtocols, res.StatusLine.StatusCode)
+	rest, err := io.ReadAll(br)
+	require.NoError(t, err)
+	assert.Equal(t, "\x81\x02hi", string(rest))
+
+	// Test: 2xx to CONNECT leaves the rest of the stream to the tunnel
+	br = bufio.NewReader(strings.NewReader("HTTP/1.1 200 Connection Established\r\n" +
+		"\r\n" +
+		"tunnelled"))
+	res, err = ResponseFromReader(br, "CONNECT")
+	require.NoError(t, err)
+	empty, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Empty(t, empty)
+	rest, err = io.ReadAll(br)
+	require.NoError(t, err)
+	assert.Equal(t, "tunnelled", string(rest))
+
+	// Test: Responses back to back on one connection
+	br = bufio.NewReaderSize(strings.NewReader("HTTP/1.1 200 OK\r\nContent-Length: 3\r\n\r\none"+
+		"HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n3\r\ntwo\r\n0\r\n\r\n"), maxLineLength)
+	for _, want := range []string{"one", "two"} {
+		res, err = ResponseFromReader(br, "GET")
+		require.NoError(t, err)
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		assert.Equal(t, want, string(body))
+	}
+}
+
+func TestResponseFromReaderErrors(t *testing.T) {
+	// Test: Malformed status lines and fields
+	for _, raw := range []string{
+		"HTTP/1.1\r\n\r\n",
+		"HTTP/2 200 OK\r\n\r\n",
+		"HTTP/1.1 20 OK\r\n\r\n",
+		"HTTP/1.1 abc OK\r\n\r\n",
+		"HTTP/1.1 200 OK\r\nno colon\r\n\r\n",
+		"HTTP/1.1 200 OK\r\nContent-Length: -1\r\n\r\n",
+		"HTTP/1.1 200 OK\r\n",
+		"HTTP/1.1 200 OK\r\nX-Long: " + strings.Repeat("a", maxLineLength) + "\r\n\r\n",
+	} {
+		_, err := ResponseFromReader(strings.NewReader(raw), "GET")
+		require.Error(t, err, raw)
+	}
+
+	// Test: Truncated and malformed bodies
+	for _, raw := range []string{
+		"HTTP/1.1 200 OK\r\nContent-Length: 10\r\n\r\nshort",
+		"HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhel",
+		"HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\nzz\r\n",
+		"HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n2\r\nhello\r\n0\r\n\r\n",
+		"HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n2\r\nhi\r\n",
+	} {
+		res, err := ResponseFromReader(strings.NewReader(raw), "GET")
+		require.NoError(t, err, raw)
+		_, err = io.ReadAll(res.Body)
+		require.Error(t, err, raw)
+	}
+}
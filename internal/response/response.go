@@ -1,8 +1,10 @@
 package response
 
 import (
+	"bufio"
 	"fmt"
 	"io"
+	"strings"
 
 	"github.com/Supasiti/prac-go-http-protocol/internal/headers"
 )
@@ -14,52 +16,240 @@ const (
 	WriterStateHeaders
 	WriterStateBody
 	WriterStateTrailers
+	WriterStateDone
 )
 
+// HeaderCase controls how field names are spelled on the wire
+type HeaderCase int
+
+const (
+	HeaderCaseCanonical HeaderCase = iota // Title-Case, e.g. Content-Length
+	HeaderCasePreserve                    // as the name was first set
+)
+
+// writeBufferSize is large enough to hold a typical status line and header block, so they
+// go out in the same write as the start of the body
+const writeBufferSize = 4096
+
 type Writer struct {
-	writer io.Writer
-	state  WriterState
+	writer     *bufio.Writer
+	dst        io.Writer
+	state      WriterState
+	header     *headers.Headers
+	headerCase HeaderCase
+	status     StatusCode
+	method     string
+	chunked    bool
+	trailers   map[string]bool
+
+	beforeHeaders  []func(w *Writer)
+	encoder        *bodyEncoder
+	bodyBufferSize int
+
+	hijacker Hijacker
+	hijacked bool
 }
 
 func NewWriter(w io.Writer) *Writer {
 	return &Writer{
-		writer: w,
+		writer: bufio.NewWriterSize(w, writeBufferSize),
+		dst:    w,
 		state:  WriterStateStatusLine,
+		header: headers.NewHeaders(),
+
+		bodyBufferSize: DefaultBodyBufferSize,
+	}
+}
+
+// Header returns the fields to be sent with the response. They can be changed by handlers
+// and middleware until the headers are written; changes made afterwards have no effect.
+func (w *Writer) Header() *headers.Headers {
+	return w.header
+}
+
+// WriteHeader writes the status line followed by the fields in Header
+func (w *Writer) WriteHeader(statusCode StatusCode) error {
+	if err := w.WriteStatusLine(statusCode); err != nil {
+		return err
 	}
+	return w.WriteHeaders(nil)
+}
+
+// Write writes p to the body, writing a 200 status line and Header first if they have not
+// been written yet.
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.state == WriterStateStatusLine {
+		if err := w.WriteStatusLine(StatusOk); err != nil {
+			return 0, err
+		}
+	}
+	if w.state == WriterStateHeaders {
+		if err := w.WriteHeaders(nil); err != nil {
+			return 0, err
+		}
+	}
+	return w.WriteBody(p)
+}
+
+// Status returns the status code written so far, or 0 before the status line
+func (w *Writer) Status() StatusCode {
+	return w.status
+}
+
+// Flush sends everything written so far to the connection. Writes are buffered, so
+// handlers that stream should call Flush whenever the client needs to see the data.
+func (w *Writer) Flush() error {
+	if w.encoder != nil {
+		if err := w.encoder.Flush(); err != nil {
+			return err
+		}
+	}
+	return w.writer.Flush()
+}
+
+// Close finishes the response and flushes it. A chunked body gets its last chunk and an
+// empty trailer section if they were not written yet. Calling Close more than once is safe.
+func (w *Writer) Close() error {
+	if w.hijacked {
+		return nil
+	}
+	switch w.state {
+	case WriterStateBody:
+		if !w.chunked {
+			w.state = WriterStateDone
+			break
+		}
+		if _, err := w.WriteChunkBodyDone(); err != nil {
+			return err
+		}
+		if err := w.WriteTrailers(nil); err != nil {
+			return err
+		}
+	case WriterStateTrailers:
+		if err := w.WriteTrailers(nil); err != nil {
+			return err
+		}
+	}
+	return w.writer.Flush()
+}
+
+func (w *Writer) SetHeaderCase(c HeaderCase) {
+	w.headerCase = c
+}
+
+// SetRequestMethod tells the writer which request it answers. Bodies of responses to HEAD
+// are discarded while their headers are written as they would be for GET.
+func (w *Writer) SetRequestMethod(method string) {
+	w.method = method
+}
+
+// bodyAllowed reports whether body bytes should reach the connection. Responses to HEAD,
+// and 1xx, 204 and 304 responses never carry a body.
+func (w *Writer) bodyAllowed() bool {
+	return w.method != "HEAD" && statusAllowsBody(w.status) && !w.tunnel()
+}
+
+// tunnel reports whether the response accepts a CONNECT, after which the connection is a
+// tunnel rather than a response body (RFC 9110 9.3.6)
+func (w *Writer) tunnel() bool {
+	return w.method == "CONNECT" && w.status.IsSuccess()
+}
+
+func statusAllowsBody(code StatusCode) bool {
+	if code == 0 {
+		// not written yet, the implicit status is 200
+		return true
+	}
+	return !code.IsInformational() && code != StatusNoContent && code != StatusNotModified
 }
 
 func (w *Writer) WriteStatusLine(statusCode StatusCode) error {
+	return w.WriteStatusLineReason(statusCode, StatusText(statusCode))
+}
+
+// WriteStatusLineReason writes the status line with a custom reason phrase
+func (w *Writer) WriteStatusLineReason(statusCode StatusCode, reason string) error {
 	if w.state != WriterStateStatusLine {
 		return fmt.Errorf("writing response out of order: %d", w.state)
 	}
+	if !statusCode.valid() {
+		return fmt.Errorf("invalid status code: %d", statusCode)
+	}
+	if !validReasonPhrase(reason) {
+		return fmt.Errorf("invalid characters in reason phrase: %q", reason)
+	}
 	defer func() { w.state = WriterStateHeaders }()
+	w.status = statusCode
 
-	line := statusLine(statusCode)
+	line := statusLine(statusCode, reason)
 	_, err := w.writer.Write([]byte(line))
 	return err
 }
 
-func (w *Writer) WriteHeaders(headers *headers.Headers) error {
+// WriteHeaders merges h into Header, overriding fields with the same name, and writes the
+// result. h may be nil to write Header as is. An interim (1xx) response carries only the
+// fields in h and leaves Header for the final response.
+func (w *Writer) WriteHeaders(h *headers.Headers) error {
 	if w.state != WriterStateHeaders {
 		return fmt.Errorf("writing response out of order: %d", w.state)
 	}
+	if w.status.IsInformational() && w.status != StatusSwitchingProtocols {
+		// the final response follows
+		w.state = WriterStateStatusLine
+		return w.writeFields(interimFields(h, w.header))
+	}
 	defer func() { w.state = WriterStateBody }()
 
-	for key, value := range headers.All() {
-		line := fmt.Sprintf("%s: %s\r\n", key, value)
-		if _, err := w.writer.Write([]byte(line)); err != nil {
-			return err
+	if h != nil && h != w.header {
+		for name, value := range h.Fields() {
+			w.header.Set(name, value)
+		}
+	}
+	if !w.status.IsInformational() && !w.tunnel() {
+		for _, fn := range w.beforeHeaders {
+			fn(w)
 		}
 	}
+	if w.status == StatusSwitchingProtocols || w.status == StatusNoContent || w.tunnel() {
+		w.header.Remove("Content-Length")
+		w.header.Remove("Transfer-Encoding")
+	}
+	w.chunked = isChunked(w.header)
+	w.trailers = declaredTrailers(w.header)
 
-	_, err := w.writer.Write([]byte("\r\n"))
-	return err
+	return w.writeFields(w.header)
+}
+
+// interimFields returns the fields of h for an interim response, without framing, which
+// belongs to the final response. Header itself is never sent on an interim response.
+func interimFields(h, header *headers.Headers) *headers.Headers {
+	fields := headers.NewHeaders()
+	if h == nil || h == header {
+		return fields
+	}
+	for name, value := range h.Fields() {
+		if !strings.EqualFold(name, "Content-Length") && !strings.EqualFold(name, "Transfer-Encoding") {
+			fields.Set(name, value)
+		}
+	}
+	return fields
+}
+
+func isChunked(h *headers.Headers) bool {
+	codings := strings.Split(h.Get("Transfer-Encoding"), ",")
+	return strings.EqualFold(strings.TrimSpace(codings[len(codings)-1]), "chunked")
 }
 
 func (w *Writer) WriteBody(p []byte) (int, error) {
 	if w.state != WriterStateBody {
 		return 0, fmt.Errorf("writing response out of order: %d", w.state)
 	}
+	if w.encoder != nil {
+		return w.encoder.Write(p)
+	}
+	if !w.bodyAllowed() {
+		return len(p), nil
+	}
 
 	return w.writer.Write(p)
 }
@@ -68,16 +258,55 @@ func (w *Writer) WriteChunkBody(p []byte) (int, error) {
 	if w.state != WriterStateBody {
 		return 0, fmt.Errorf("writing response out of order: %d", w.state)
 	}
+	if !w.chunked && w.encoder == nil {
+		return 0, fmt.Errorf("writing a chunk to a body that is not chunked")
+	}
+	if w.encoder != nil {
+		return w.encoder.Write(p)
+	}
+	return w.writeChunk(p, "")
+}
+
+// WriteChunkBodyExt writes p as a single chunk with extensions on its chunk-size line.
+// Extensions cannot be used while a body encoder reshapes the chunks.
+func (w *Writer) WriteChunkBodyExt(p []byte, ext ...ChunkExtension) (int, error) {
+	if w.state != WriterStateBody {
+		return 0, fmt.Errorf("writing response out of order: %d", w.state)
+	}
+	if w.encoder != nil {
+		return 0, fmt.Errorf("chunk extensions cannot be used with a body encoder")
+	}
+	if len(p) == 0 {
+		return 0, fmt.Errorf("empty chunk would end the body, use WriteChunkBodyDone")
+	}
+
+	extStr, err := formatChunkExtensions(ext)
+	if err != nil {
+		return 0, err
+	}
+	return w.writeChunk(p, extStr)
+}
+
+// writeChunk frames p as a single chunk, bypassing the body encoder
+func (w *Writer) writeChunk(p []byte, ext string) (int, error) {
+	if !w.bodyAllowed() {
+		return len(p), nil
+	}
 
 	nTotal := 0
-	n, err := fmt.Fprintf(w.writer, "%X\r\n", len(p))
+	n, err := fmt.Fprintf(w.writer, "%X%s\r\n", len(p), ext)
 	if err != nil {
 		return nTotal, err
 	}
 	nTotal += n
 
-	body := fmt.Appendf(p, "\r\n")
-	n, err = w.writer.Write(body)
+	n, err = w.writer.Write(p)
+	nTotal += n
+	if err != nil {
+		return nTotal, err
+	}
+
+	n, err = w.writer.Write([]byte("\r\n"))
 	nTotal += n
 
 	return nTotal, err
@@ -87,24 +316,54 @@ func (w *Writer) WriteChunkBodyDone() (int, error) {
 	if w.state != WriterStateBody {
 		return 0, fmt.Errorf("writing response out of order: %d", w.state)
 	}
+	if !w.chunked && w.encoder == nil {
+		return 0, fmt.Errorf("ending a body that is not chunked")
+	}
 	defer func() { w.state = WriterStateTrailers }()
+	if w.encoder != nil {
+		// flush whatever the encoder still holds before the last chunk
+		err := w.encoder.Close()
+		w.encoder = nil
+		if err != nil {
+			return 0, err
+		}
+	}
+	if !w.bodyAllowed() {
+		return 0, nil
+	}
 
 	body := []byte("0\r\n")
 	return w.writer.Write(body)
 }
 
+// WriteTrailers ends a chunked body with the trailer fields in h. Every field must have
+// been declared in the Trailer header, and fields that control framing, routing,
+// authentication or the response itself are rejected.
 func (w *Writer) WriteTrailers(h *headers.Headers) error {
 	if w.state != WriterStateTrailers {
 		return fmt.Errorf("writing response out of order: %d", w.state)
 	}
+	if err := w.validateTrailers(h); err != nil {
+		return err
+	}
+	defer func() { w.state = WriterStateDone }()
+	if !w.bodyAllowed() {
+		return nil
+	}
 
+	return w.writeFields(h)
+}
+
+// writeFields writes a field block in insertion order followed by the empty line
+func (w *Writer) writeFields(h *headers.Headers) error {
 	if h != nil {
-		for key, value := range h.All() {
-			line := fmt.Sprintf("%s: %s\r\n", key, value)
+		for name, value := range h.Fields() {
+			if w.headerCase == HeaderCaseCanonical {
+				name = headers.CanonicalKey(name)
+			}
 
-			fmt.Println(line)
-			_, err := w.writer.Write([]byte(line))
-			if err != nil {
+			line := fmt.Sprintf("%s: %s\r\n", name, value)
+			if _, err := w.writer.Write([]byte(line)); err != nil {
 				return err
 			}
 		}
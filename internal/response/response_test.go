@@ -0,0 +1,400 @@
+package response
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Supasiti/prac-go-http-protocol/internal/headers"
+)
+
+func flushed(t *testing.T, w *Writer, buf *bytes.Buffer) string {
+	require.NoError(t, w.Flush())
+	return buf.String()
+}
+
+func TestWriterHeaders(t *testing.T) {
+	// Test: Default headers in insertion order and canonical case
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusOk))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(5)))
+	_, err := w.WriteBody([]byte("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Length: 5\r\n"+
+		"Connection: close\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"\r\n"+
+		"hello", flushed(t, w, buf))
+
+	// Test: Preserve names as set
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.SetHeaderCase(HeaderCasePreserve)
+	h := headers.NewHeaders()
+	h.Set("x-lower", "1")
+	h.Set("ETag", `"abc"`)
+	require.NoError(t, w.WriteStatusLine(StatusOk))
+	require.NoError(t, w.WriteHeaders(h))
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"x-lower: 1\r\n"+
+		"ETag: \"abc\"\r\n"+
+		"\r\n", flushed(t, w, buf))
+
+	// Test: Trailers in insertion order
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	h = headers.NewHeaders()
+	h.Set("transfer-encoding", "chunked")
+	h.Set("trailer", "X-Checksum, X-Length")
+	require.NoError(t, w.WriteStatusLine(StatusOk))
+	require.NoError(t, w.WriteHeaders(h))
+	_, err = w.WriteChunkBody([]byte("hi"))
+	require.NoError(t, err)
+	_, err = w.WriteChunkBodyDone()
+	require.NoError(t, err)
+	trailers := headers.NewHeaders()
+	trailers.Set("x-checksum", "abc")
+	trailers.Set("x-length", "2")
+	require.NoError(t, w.WriteTrailers(trailers))
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Transfer-Encoding: chunked\r\n"+
+		"Trailer: X-Checksum, X-Length\r\n"+
+		"\r\n"+
+		"2\r\nhi\r\n"+
+		"0\r\n"+
+		"X-Checksum: abc\r\n"+
+		"X-Length: 2\r\n"+
+		"\r\n", flushed(t, w, buf))
+
+	// Test: Out of order writes
+	w = NewWriter(&bytes.Buffer{})
+	require.Error(t, w.WriteHeaders(headers.NewHeaders()))
+}
+
+func TestWriterHeaderMap(t *testing.T) {
+	// Test: Implicit 200 on first body write
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.Header().Set("Content-Type", "text/plain")
+	w.Header().Set("Content-Length", "2")
+	_, err := w.Write([]byte("hi"))
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"Content-Length: 2\r\n"+
+		"\r\n"+
+		"hi", flushed(t, w, buf))
+
+	// Test: WriteHeader commits Header
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.Header().Set("Location", "/elsewhere")
+	require.NoError(t, w.WriteHeader(StatusFound))
+	w.Header().Set("X-Too-Late", "1")
+	assert.Equal(t, "HTTP/1.1 302 Found\r\n"+
+		"Location: /elsewhere\r\n"+
+		"\r\n", flushed(t, w, buf))
+
+	// Test: Headers passed to WriteHeaders are merged over Header
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.Header().Set("X-Middleware", "yes")
+	w.Header().Set("Content-Type", "application/octet-stream")
+	require.NoError(t, w.WriteStatusLine(StatusOk))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(0)))
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"X-Middleware: yes\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"Content-Length: 0\r\n"+
+		"Connection: close\r\n"+
+		"\r\n", flushed(t, w, buf))
+
+	// Test: Status line cannot be written twice
+	require.Error(t, w.WriteHeader(StatusOk))
+}
+
+func TestWriterBody(t *testing.T) {
+	// Test: Small body gets a Content-Length
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.Header().Set("Content-Type", "text/plain")
+	body := w.Body()
+	_, err := body.Write([]byte("hello "))
+	require.NoError(t, err)
+	_, err = body.Write([]byte("world"))
+	require.NoError(t, err)
+	require.NoError(t, body.Close())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"Content-Length: 11\r\n"+
+		"\r\n"+
+		"hello world", flushed(t, w, buf))
+
+	// Test: Empty body
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusNotFound))
+	require.NoError(t, w.Body().Close())
+	assert.Equal(t, "HTTP/1.1 404 Not Found\r\n"+
+		"Content-Length: 0\r\n"+
+		"\r\n", flushed(t, w, buf))
+
+	// Test: Switch to chunked once the buffer is exceeded
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.SetBodyBufferSize(4)
+	w.Header().Set("Content-Length", "999")
+	body = w.Body()
+	_, err = body.Write([]byte("abc"))
+	require.NoError(t, err)
+	_, err = body.Write([]byte("defgh"))
+	require.NoError(t, err)
+	_, err = body.Write([]byte("i"))
+	require.NoError(t, err)
+	require.NoError(t, body.Close())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Transfer-Encoding: chunked\r\n"+
+		"\r\n"+
+		"3\r\nabc\r\n"+
+		"5\r\ndefgh\r\n"+
+		"1\r\ni\r\n"+
+		"0\r\n"+
+		"\r\n", flushed(t, w, buf))
+
+	// Test: Write after close
+	_, err = body.Write([]byte("late"))
+	require.Error(t, err)
+
+	// Test: Headers already written with a Content-Length keep it
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.Header().Set("Content-Length", "5")
+	require.NoError(t, w.WriteHeader(StatusOk))
+	body = w.Body()
+	_, err = body.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, body.Close())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Length: 5\r\n"+
+		"\r\n"+
+		"hello", flushed(t, w, buf))
+
+	// Test: Headers already written as chunked stream chunks
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.Header().Set("Transfer-Encoding", "chunked")
+	require.NoError(t, w.WriteHeader(StatusOk))
+	body = w.Body()
+	_, err = body.Write([]byte("abc"))
+	require.NoError(t, err)
+	require.NoError(t, body.Close())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Transfer-Encoding: chunked\r\n"+
+		"\r\n"+
+		"3\r\nabc\r\n"+
+		"0\r\n"+
+		"\r\n", flushed(t, w, buf))
+
+	// Test: Body after the response is finished
+	w = NewWriter(&bytes.Buffer{})
+	require.NoError(t, w.WriteHeader(StatusOk))
+	require.NoError(t, w.Close())
+	_, err = w.Body().Write([]byte("late"))
+	require.Error(t, err)
+}
+
+func TestWriterNoBody(t *testing.T) {
+	// Test: HEAD keeps headers and drops the body
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.SetRequestMethod("HEAD")
+	require.NoError(t, w.WriteStatusLine(StatusOk))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(5)))
+	n, err := w.WriteBody([]byte("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Length: 5\r\n"+
+		"Connection: close\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"\r\n", flushed(t, w, buf))
+
+	// Test: HEAD with Body reports the length GET would have sent
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.SetRequestMethod("HEAD")
+	w.SetBodyBufferSize(4)
+	body := w.Body()
+	_, err = body.Write([]byte("more than four bytes"))
+	require.NoError(t, err)
+	require.NoError(t, body.Close())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Length: 20\r\n"+
+		"\r\n", flushed(t, w, buf))
+
+	// Test: HEAD with chunked body drops chunks and trailers
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.SetRequestMethod("HEAD")
+	w.Header().Set("Transfer-Encoding", "chunked")
+	require.NoError(t, w.WriteHeader(StatusOk))
+	_, err = w.WriteChunkBody([]byte("abc"))
+	require.NoError(t, err)
+	_, err = w.WriteChunkBodyDone()
+	require.NoError(t, err)
+	require.NoError(t, w.WriteTrailers(nil))
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Transfer-Encoding: chunked\r\n"+
+		"\r\n", flushed(t, w, buf))
+
+	// Test: 204 drops the body and framing headers
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusNoContent))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(5)))
+	_, err = w.WriteBody([]byte("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 204 No Content\r\n"+
+		"Connection: close\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"\r\n", flushed(t, w, buf))
+
+	// Test: 304 keeps Content-Length and drops the body
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.Header().Set("Content-Length", "100")
+	require.NoError(t, w.WriteStatusLine(StatusNotModified))
+	body = w.Body()
+	_, err = body.Write([]byte("ignored"))
+	require.NoError(t, err)
+	require.NoError(t, body.Close())
+	assert.Equal(t, "HTTP/1.1 304 Not Modified\r\n"+
+		"Content-Length: 100\r\n"+
+		"\r\n", flushed(t, w, buf))
+
+	// Test: 2xx to CONNECT has no framing headers and skips the header hooks
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.SetRequestMethod("CONNECT")
+	w.BeforeWriteHeaders(func(w *Writer) {
+		w.Header().Set("Transfer-Encoding", "chunked")
+	})
+	w.Header().Set("Content-Length", "0")
+	require.NoError(t, w.WriteStatusLineReason(StatusOk, "Connection Established"))
+	require.NoError(t, w.WriteHeaders(nil))
+	_, err = w.WriteBody([]byte("ignored"))
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 200 Connection Established\r\n"+
+		"\r\n", flushed(t, w, buf))
+
+	// Test: Interim response is followed by the final response
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	require.NoError(t, w.WriteHeader(StatusContinue))
+	_, err = w.Write([]byte("ok"))
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 100 Continue\r\n"+
+		"\r\n"+
+		"HTTP/1.1 200 OK\r\n"+
+		"\r\n"+
+		"ok", flushed(t, w, buf))
+
+	// Test: Interim response leaves the fields of the final one alone
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.Header().Set("Content-Length", "5")
+	w.Header().Set("Content-Type", "text/plain")
+	hints := headers.NewHeaders()
+	hints.Set("Link", "</style.css>; rel=preload")
+	hints.Set("Content-Length", "9")
+	require.NoError(t, w.WriteStatusLine(StatusEarlyHints))
+	require.NoError(t, w.WriteHeaders(hints))
+	require.NoError(t, w.WriteHeader(StatusContinue))
+	require.NoError(t, w.WriteHeader(StatusOk))
+	_, err = w.WriteBody([]byte("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 103 Early Hints\r\n"+
+		"Link: </style.css>; rel=preload\r\n"+
+		"\r\n"+
+		"HTTP/1.1 100 Continue\r\n"+
+		"\r\n"+
+		"HTTP/1.1 200 OK\r\n"+
+		"Content-Length: 5\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"\r\n"+
+		"hello", flushed(t, w, buf))
+}
+
+func TestWriterFlush(t *testing.T) {
+	// Test: Status line, headers and small body go out in one write
+	conn := &countingWriter{}
+	w := NewWriter(conn)
+	require.NoError(t, w.WriteStatusLine(StatusOk))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(5)))
+	_, err := w.WriteBody([]byte("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, 0, conn.writes)
+	require.NoError(t, w.Close())
+	assert.Equal(t, 1, conn.writes)
+
+	// Test: Flush pushes chunks out while streaming
+	conn = &countingWriter{}
+	w = NewWriter(conn)
+	w.Header().Set("Transfer-Encoding", "chunked")
+	require.NoError(t, w.WriteHeader(StatusOk))
+	_, err = w.WriteChunkBody([]byte("first"))
+	require.NoError(t, err)
+	require.NoError(t, w.Flush())
+	assert.Equal(t, 1, conn.writes)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nfirst\r\n", conn.String())
+	require.NoError(t, w.Close())
+	assert.Equal(t, 2, conn.writes)
+	assert.True(t, bytes.HasSuffix(conn.Bytes(), []byte("0\r\n\r\n")))
+}
+
+type countingWriter struct {
+	bytes.Buffer
+	writes int
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.writes++
+	return c.Buffer.Write(p)
+}
+
+func TestWriterHijack(t *testing.T) {
+	// Test: No hijacker set
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	_, _, err := w.Hijack()
+	require.ErrorIs(t, err, ErrNotHijackable)
+
+	// Test: Pending output is flushed before the connection is handed over
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+	w = NewWriter(buf)
+	w.SetHijacker(func() (net.Conn, []byte, error) {
+		return a, []byte("early"), nil
+	})
+	require.NoError(t, w.WriteStatusLine(StatusSwitchingProtocols))
+	conn, buffered, err := w.Hijack()
+	require.NoError(t, err)
+	assert.Equal(t, a, conn)
+	assert.Equal(t, "early", string(buffered))
+	assert.Equal(t, "HTTP/1.1 101 Switching Protocols\r\n", buf.String())
+	assert.True(t, w.Hijacked())
+
+	// Test: The writer is finished after a hijack
+	_, _, err = w.Hijack()
+	require.ErrorIs(t, err, ErrHijacked)
+	_, err = w.WriteBody([]byte("late"))
+	require.Error(t, err)
+	require.NoError(t, w.Close())
+	assert.Equal(t, "HTTP/1.1 101 Switching Protocols\r\n", buf.String())
+}
@@ -0,0 +1,97 @@
+package response
+
+import (
+	"fmt"
+	"io"
+)
+
+// copyBufferSize is the size of the buffer ReadFrom copies through when the body has to be
+// framed or encoded
+const copyBufferSize = 32 * 1024
+
+// ReadFrom writes everything read from r to the body, like Write. With a plain body going
+// straight to the connection, the buffered output is flushed and r is copied to the
+// connection directly, so an *os.File sent to a TCP connection uses sendfile or splice
+// instead of passing through user space. Chunked and encoded bodies are copied through a
+// buffer instead. When the response has no body, a seekable r is skipped, not read.
+func (w *Writer) ReadFrom(r io.Reader) (int64, error) {
+	if w.state == WriterStateStatusLine {
+		if err := w.WriteStatusLine(StatusOk); err != nil {
+			return 0, err
+		}
+	}
+	if w.state == WriterStateHeaders {
+		if err := w.WriteHeaders(nil); err != nil {
+			return 0, err
+		}
+	}
+	if w.state != WriterStateBody {
+		return 0, fmt.Errorf("writing response out of order: %d", w.state)
+	}
+
+	if !w.bodyAllowed() {
+		return skip(r)
+	}
+	if w.chunked || w.encoder != nil {
+		return io.CopyBuffer(chunkedBody{w}, r, make([]byte, copyBufferSize))
+	}
+
+	if err := w.writer.Flush(); err != nil {
+		return 0, err
+	}
+	// io.Copy hands off to the connection's ReadFrom, or the file's WriteTo
+	return io.Copy(w.dst, r)
+}
+
+// skip passes over the rest of r for a body that is not sent. Seekers, also behind the
+// io.LimitedReader of io.CopyN, are skipped without reading; anything else is drained, as
+// only reading tells its length.
+func skip(r io.Reader) (int64, error) {
+	if lr, ok := r.(*io.LimitedReader); ok {
+		if s, ok := lr.R.(io.Seeker); ok {
+			n, err := skipSeeker(s, lr.N)
+			lr.N -= n
+			return n, err
+		}
+	}
+	if s, ok := r.(io.Seeker); ok {
+		return skipSeeker(s, -1)
+	}
+	return io.Copy(io.Discard, r)
+}
+
+// skipSeeker moves s forward by up to limit bytes, or to its end when limit is negative
+func skipSeeker(s io.Seeker, limit int64) (int64, error) {
+	offset, err := s.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	end, err := s.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	n := end - offset
+	if limit >= 0 && limit < n {
+		n = limit
+		if _, err := s.Seek(offset+n, io.SeekStart); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// chunkedBody writes each buffer as a chunk. It hides Writer.ReadFrom from io.Copy, which
+// would otherwise call straight back into it.
+type chunkedBody struct {
+	w *Writer
+}
+
+func (c chunkedBody) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if _, err := c.w.WriteChunkBody(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,106 @@
+package response
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readerFromConn records whether the body was handed to its ReadFrom, as a TCP connection
+// would be for sendfile
+type readerFromConn struct {
+	bytes.Buffer
+	readFrom bool
+}
+
+func (c *readerFromConn) ReadFrom(r io.Reader) (int64, error) {
+	c.readFrom = true
+	return c.Buffer.ReadFrom(r)
+}
+
+// countingReader counts the reads of the reader it wraps, which can still seek
+type countingReader struct {
+	*strings.Reader
+	reads int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	r.reads++
+	return r.Reader.Read(p)
+}
+
+func TestWriterReadFrom(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "video.mp4")
+	require.NoError(t, os.WriteFile(path, []byte("not really a video"), 0o644))
+
+	// Test: Plain body goes to the connection's ReadFrom after the headers
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	conn := &readerFromConn{}
+	w := NewWriter(conn)
+	w.Header().Set("Content-Length", "18")
+	n, err := io.Copy(w, f)
+	require.NoError(t, err)
+	assert.Equal(t, int64(18), n)
+	assert.True(t, conn.readFrom)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Length: 18\r\n"+
+		"\r\n"+
+		"not really a video", conn.String())
+
+	// Test: Chunked body is framed through a buffer
+	conn = &readerFromConn{}
+	w = NewWriter(conn)
+	w.Header().Set("Transfer-Encoding", "chunked")
+	_, err = w.ReadFrom(strings.NewReader("hello"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	assert.False(t, conn.readFrom)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Transfer-Encoding: chunked\r\n"+
+		"\r\n"+
+		"5\r\nhello\r\n"+
+		"0\r\n\r\n", conn.String())
+
+	// Test: HEAD discards the body
+	conn = &readerFromConn{}
+	w = NewWriter(conn)
+	w.SetRequestMethod("HEAD")
+	w.Header().Set("Content-Length", "5")
+	n, err = w.ReadFrom(strings.NewReader("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), n)
+	require.NoError(t, w.Close())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Length: 5\r\n"+
+		"\r\n", conn.String())
+
+	// Test: Body that is not sent is not read, also through io.CopyN
+	conn = &readerFromConn{}
+	w = NewWriter(conn)
+	w.SetRequestMethod("HEAD")
+	w.Header().Set("Content-Length", "5")
+	r := &countingReader{Reader: strings.NewReader("hello world")}
+	n, err = w.ReadFrom(r)
+	require.NoError(t, err)
+	assert.Equal(t, int64(11), n)
+	r.Seek(6, io.SeekStart)
+	n, err = io.CopyN(w, r, 3)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+	rest, _ := io.ReadAll(r)
+	assert.Equal(t, "ld", string(rest))
+	assert.Equal(t, 2, r.reads)
+	require.NoError(t, w.Close())
+
+	// Test: Out of order
+	_, err = w.ReadFrom(strings.NewReader("late"))
+	require.Error(t, err)
+}
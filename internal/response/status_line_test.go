@@ -0,0 +1,49 @@
+package response
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatusLine(t *testing.T) {
+	// Test: Registered reason phrase
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusNotFound))
+	assert.Equal(t, "HTTP/1.1 404 Not Found\r\n", flushed(t, w, buf))
+
+	// Test: Unknown code keeps an empty reason phrase
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusCode(599)))
+	assert.Equal(t, "HTTP/1.1 599 \r\n", flushed(t, w, buf))
+
+	// Test: Custom reason phrase
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	require.NoError(t, w.WriteStatusLineReason(StatusOk, "Totally Fine"))
+	assert.Equal(t, "HTTP/1.1 200 Totally Fine\r\n", flushed(t, w, buf))
+
+	// Test: Reason phrase cannot break the status line
+	w = NewWriter(&bytes.Buffer{})
+	require.Error(t, w.WriteStatusLineReason(StatusOk, "OK\r\nX-Injected: 1"))
+
+	// Test: Status code must have 3 digits
+	w = NewWriter(&bytes.Buffer{})
+	require.Error(t, w.WriteStatusLine(StatusCode(42)))
+}
+
+func TestStatusCode(t *testing.T) {
+	assert.Equal(t, "Range Not Satisfiable", StatusText(StatusRangeNotSatisfiable))
+	assert.Equal(t, "", StatusText(StatusCode(299)))
+
+	assert.True(t, StatusSwitchingProtocols.IsInformational())
+	assert.True(t, StatusNoContent.IsSuccess())
+	assert.True(t, StatusNotModified.IsRedirect())
+	assert.True(t, StatusTooManyRequests.IsClientError())
+	assert.True(t, StatusGatewayTimeout.IsServerError())
+	assert.False(t, StatusOk.IsClientError())
+}
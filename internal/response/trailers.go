@@ -0,0 +1,154 @@
+package response
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Supasiti/prac-go-http-protocol/internal/headers"
+)
+
+// forbiddenTrailers cannot be sent in a trailer section (RFC 9110 6.5.1)
+var forbiddenTrailers = map[string]bool{
+	// message framing
+	"transfer-encoding": true,
+	"content-length":    true,
+	"trailer":           true,
+	"connection":        true,
+	"keep-alive":        true,
+	"te":                true,
+	"upgrade":           true,
+	// routing
+	"host": true,
+	// request modifiers
+	"cache-control":       true,
+	"expect":              true,
+	"max-forwards":        true,
+	"pragma":              true,
+	"range":               true,
+	"if-match":            true,
+	"if-none-match":       true,
+	"if-modified-since":   true,
+	"if-unmodified-since": true,
+	"if-range":            true,
+	// authentication
+	"authorization":       true,
+	"proxy-authenticate":  true,
+	"proxy-authorization": true,
+	"www-authenticate":    true,
+	"set-cookie":          true,
+	"cookie":              true,
+	// response control data
+	"age":         true,
+	"date":        true,
+	"expires":     true,
+	"location":    true,
+	"retry-after": true,
+	"vary":        true,
+	"warning":     true,
+	// content processing
+	"content-encoding": true,
+	"content-type":     true,
+	"content-range":    true,
+}
+
+type ChunkExtension struct {
+	Name  string
+	Value string
+}
+
+// declaredTrailers collects the lowercased field names listed in the Trailer header
+func declaredTrailers(h *headers.Headers) map[string]bool {
+	declared := make(map[string]bool)
+	for _, name := range strings.Split(h.Get("Trailer"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "" {
+			declared[name] = true
+		}
+	}
+	return declared
+}
+
+func (w *Writer) validateTrailers(h *headers.Headers) error {
+	if h == nil || h.Len() == 0 {
+		return nil
+	}
+	if !w.chunked {
+		return fmt.Errorf("trailers require chunked transfer coding")
+	}
+
+	for key := range h.All() {
+		if forbiddenTrailers[key] {
+			return fmt.Errorf("field not allowed in trailers: %s", key)
+		}
+		if !w.trailers[key] {
+			return fmt.Errorf("trailer field not declared in Trailer header: %s", key)
+		}
+	}
+	return nil
+}
+
+// AllowedTrailers returns the fields of h that WriteTrailers accepts for this response:
+// those declared in its Trailer header and not forbidden. A relay passes trailers it did
+// not produce through it, so one stray field does not cost the whole trailer section.
+func (w *Writer) AllowedTrailers(h *headers.Headers) *headers.Headers {
+	allowed := headers.NewHeaders()
+	if h == nil || !w.chunked {
+		return allowed
+	}
+	for name, value := range h.Fields() {
+		key := strings.ToLower(name)
+		if w.trailers[key] && !forbiddenTrailers[key] {
+			allowed.Set(name, value)
+		}
+	}
+	return allowed
+}
+
+// formatChunkExtensions renders extensions as `;name=value`, quoting values that are not
+// tokens
+func formatChunkExtensions(ext []ChunkExtension) (string, error) {
+	var b strings.Builder
+	for _, e := range ext {
+		if e.Name == "" || !isToken(e.Name) {
+			return "", fmt.Errorf("invalid chunk extension name: %q", e.Name)
+		}
+
+		b.WriteByte(';')
+		b.WriteString(e.Name)
+		if e.Value == "" {
+			continue
+		}
+
+		b.WriteByte('=')
+		if isToken(e.Value) {
+			b.WriteString(e.Value)
+			continue
+		}
+		if strings.ContainsAny(e.Value, "\r\n") {
+			return "", fmt.Errorf("invalid chunk extension value: %q", e.Value)
+		}
+		b.WriteByte('"')
+		for i := 0; i < len(e.Value); i++ {
+			if e.Value[i] == '"' || e.Value[i] == '\\' {
+				b.WriteByte('\\')
+			}
+			b.WriteByte(e.Value[i])
+		}
+		b.WriteByte('"')
+	}
+	return b.String(), nil
+}
+
+func isToken(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') {
+			continue
+		}
+		if strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0 {
+			continue
+		}
+		return false
+	}
+	return s != ""
+}
@@ -0,0 +1,91 @@
+package response
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Supasiti/prac-go-http-protocol/internal/headers"
+)
+
+func newChunkedWriter(t *testing.T, trailer string) (*Writer, *bytes.Buffer) {
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.Header().Set("Transfer-Encoding", "chunked")
+	if trailer != "" {
+		w.Header().Set("Trailer", trailer)
+	}
+	require.NoError(t, w.WriteHeader(StatusOk))
+	require.NoError(t, w.Flush())
+	buf.Reset()
+	return w, buf
+}
+
+func TestWriterTrailers(t *testing.T) {
+	// Test: Declared trailer is written
+	w, buf := newChunkedWriter(t, "X-Checksum")
+	_, err := w.WriteChunkBodyDone()
+	require.NoError(t, err)
+	trailers := headers.NewHeaders()
+	trailers.Set("X-Checksum", "abc")
+	require.NoError(t, w.WriteTrailers(trailers))
+	assert.Equal(t, "0\r\nX-Checksum: abc\r\n\r\n", flushed(t, w, buf))
+
+	// Test: Undeclared trailer is rejected and nothing is written
+	w, buf = newChunkedWriter(t, "X-Checksum")
+	_, err = w.WriteChunkBodyDone()
+	require.NoError(t, err)
+	trailers = headers.NewHeaders()
+	trailers.Set("X-Other", "abc")
+	require.Error(t, w.WriteTrailers(trailers))
+	assert.Equal(t, "0\r\n", flushed(t, w, buf))
+
+	// Test: Forbidden trailer is rejected even when declared
+	w, _ = newChunkedWriter(t, "Content-Length")
+	_, err = w.WriteChunkBodyDone()
+	require.NoError(t, err)
+	trailers = headers.NewHeaders()
+	trailers.Set("Content-Length", "10")
+	require.Error(t, w.WriteTrailers(trailers))
+
+	// Test: Chunks and trailers on a Content-Length response leave the body alone
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.Header().Set("Content-Length", "2")
+	w.Header().Set("Trailer", "X-Checksum")
+	require.NoError(t, w.WriteHeader(StatusOk))
+	_, err = w.WriteChunkBody([]byte("hi"))
+	require.Error(t, err)
+	_, err = w.WriteChunkBodyDone()
+	require.Error(t, err)
+	_, err = w.WriteBody([]byte("hi"))
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(flushed(t, w, buf), "\r\n\r\nhi"))
+	trailers = headers.NewHeaders()
+	trailers.Set("X-Checksum", "abc")
+	require.Error(t, w.WriteTrailers(trailers))
+
+	// Test: Empty trailer section is always fine
+	w, buf = newChunkedWriter(t, "")
+	require.NoError(t, w.Close())
+	assert.Equal(t, "0\r\n\r\n", flushed(t, w, buf))
+}
+
+func TestWriterChunkExtensions(t *testing.T) {
+	// Test: Token and quoted values
+	w, buf := newChunkedWriter(t, "")
+	_, err := w.WriteChunkBodyExt([]byte("hi"), ChunkExtension{Name: "sig", Value: "abc"}, ChunkExtension{Name: "note", Value: `a "b"`}, ChunkExtension{Name: "flag"})
+	require.NoError(t, err)
+	assert.Equal(t, "2;sig=abc;note=\"a \\\"b\\\"\";flag\r\nhi\r\n", flushed(t, w, buf))
+
+	// Test: Invalid name
+	_, err = w.WriteChunkBodyExt([]byte("hi"), ChunkExtension{Name: "bad name"})
+	require.Error(t, err)
+
+	// Test: Value cannot break the chunk-size line
+	_, err = w.WriteChunkBodyExt([]byte("hi"), ChunkExtension{Name: "x", Value: "a\r\nb"})
+	require.Error(t, err)
+}
@@ -0,0 +1,30 @@
+package server
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/Supasiti/prac-go-http-protocol/internal/headers"
+)
+
+type cachedDate struct {
+	unix  int64
+	value string
+}
+
+// dateCache formats the Date header at most once per second and shares the result
+// between connections
+type dateCache struct {
+	cur atomic.Pointer[cachedDate]
+}
+
+func (c *dateCache) get(now time.Time) string {
+	unix := now.Unix()
+	if d := c.cur.Load(); d != nil && d.unix == unix {
+		return d.value
+	}
+
+	d := &cachedDate{unix: unix, value: headers.FormatTime(now)}
+	c.cur.Store(d)
+	return d.value
+}
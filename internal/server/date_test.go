@@ -0,0 +1,24 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDateCache(t *testing.T) {
+	c := &dateCache{}
+	now := time.Date(2024, time.March, 9, 8, 7, 6, 0, time.FixedZone("AEST", 10*60*60))
+
+	// Test: IMF-fixdate in GMT
+	assert.Equal(t, "Fri, 08 Mar 2024 22:07:06 GMT", c.get(now))
+
+	// Test: Same second reuses the formatted value
+	first := c.cur.Load()
+	c.get(now.Add(500 * time.Millisecond))
+	assert.Same(t, first, c.cur.Load())
+
+	// Test: Next second is formatted again
+	assert.Equal(t, "Fri, 08 Mar 2024 22:07:07 GMT", c.get(now.Add(time.Second)))
+}
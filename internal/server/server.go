@@ -5,6 +5,7 @@ import (
 	"log"
 	"net"
 	"sync/atomic"
+	"time"
 
 	"github.com/Supasiti/prac-go-http-protocol/internal/request"
 	"github.com/Supasiti/prac-go-http-protocol/internal/response"
@@ -12,12 +13,29 @@ import (
 
 const handlerBufSize = 1024
 
+const DefaultServerName = "prac-go-http-protocol"
+
+// Handler writes the response to a request. HEAD requests are handed to the handler like
+// GET; the writer discards the body and keeps the headers.
 type Handler func(w *response.Writer, req *request.Request)
 
 type Server struct {
 	handler  Handler
 	listener net.Listener
 	closed   atomic.Bool
+
+	name  string
+	dates dateCache
+}
+
+type Option func(*Server)
+
+// WithServerName sets the Server header sent with every response. An empty name
+// disables the header.
+func WithServerName(name string) Option {
+	return func(s *Server) {
+		s.name = name
+	}
 }
 
 func (s *Server) Close() error {
@@ -28,6 +46,11 @@ func (s *Server) Close() error {
 	return nil
 }
 
+// Addr returns the address the server listens on, useful with port 0
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
 func (s *Server) listen() {
 	for {
 		conn, err := s.listener.Accept()
@@ -45,9 +68,15 @@ func (s *Server) listen() {
 
 func (s *Server) handle(conn net.Conn) {
 	log.Printf("Connection %s has been accepted\n", conn.LocalAddr())
-	defer conn.Close()
 
 	res := response.NewWriter(conn)
+	defer func() {
+		// a hijacked connection belongs to the handler now
+		if !res.Hijacked() {
+			conn.Close()
+		}
+	}()
+	s.setDefaultHeaders(res)
 
 	// Parse the request
 	req, err := request.RequestFromReader(conn)
@@ -58,17 +87,45 @@ func (s *Server) handle(conn net.Conn) {
 		res.WriteStatusLine(response.StatusBadRequest)
 		res.WriteHeaders(response.GetDefaultHeaders(len(msg)))
 		res.WriteBody(msg)
+		res.Close()
 		return
 	}
 	log.Printf("Received %s request on %s\n", req.RequestLine.Method, req.RequestLine.RequestTarget)
+	req.RemoteAddr = conn.RemoteAddr().String()
+	res.SetRequestMethod(req.RequestLine.Method)
+	res.SetHijacker(func() (net.Conn, []byte, error) {
+		return conn, req.Buffered(), nil
+	})
 
 	// Calling handler
 	s.handler(res, req)
+	if res.Hijacked() {
+		log.Printf("Connection %s has been hijacked\n", conn.LocalAddr())
+		return
+	}
+	if err := res.Close(); err != nil {
+		log.Printf("Error finishing response: %s\n", err)
+		return
+	}
 
 	log.Printf("Successfully wrote response\n")
 }
 
-func Serve(port int, handler Handler) (*Server, error) {
+// setDefaultHeaders adds the fields every response carries. Date is stamped as the
+// headers are written, so time spent reading the request or in the handler does not leave
+// it behind. Handlers can override both through the writer before the headers are written.
+func (s *Server) setDefaultHeaders(w *response.Writer) {
+	if s.name != "" {
+		w.Header().Set("Server", s.name)
+	}
+	w.BeforeWriteHeaders(func(w *response.Writer) {
+		if w.Header().Get("Date") == "" {
+			w.Header().Set("Date", s.dates.get(time.Now()))
+		}
+	})
+}
+
+func Serve(port int, handler Handler, opts ...Option) (*Server, error) {
 	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
 	if err != nil {
 		return nil, fmt.Errorf("Fail to create listener: %s", err)
@@ -77,6 +134,10 @@ func Serve(port int, handler Handler) (*Server, error) {
 	server := &Server{
 		handler:  handler,
 		listener: listener,
+		name:     DefaultServerName,
+	}
+	for _, opt := range opts {
+		opt(server)
 	}
 
 	go server.listen()
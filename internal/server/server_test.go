@@ -0,0 +1,52 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Supasiti/prac-go-http-protocol/internal/headers"
+	"github.com/Supasiti/prac-go-http-protocol/internal/request"
+	"github.com/Supasiti/prac-go-http-protocol/internal/response"
+)
+
+func roundTrip(t *testing.T, handler Handler) *response.Response {
+	s, err := Serve(0, handler)
+	require.NoError(t, err)
+	defer s.Close()
+
+	conn, err := net.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	res, err := response.ResponseFromReader(bufio.NewReader(conn), "GET")
+	require.NoError(t, err)
+	return res
+}
+
+func TestServerDefaultHeaders(t *testing.T) {
+	// Test: Date is stamped when the headers are written, not when the request arrives
+	var early string
+	res := roundTrip(t, func(w *response.Writer, req *request.Request) {
+		early = w.Header().Get("Date")
+		w.Header().Set("Content-Length", "0")
+		w.WriteHeader(response.StatusOk)
+	})
+	assert.Equal(t, "", early)
+	_, err := headers.ParseTime(res.Headers.Get("Date"))
+	require.NoError(t, err)
+	assert.Equal(t, DefaultServerName, res.Headers.Get("Server"))
+
+	// Test: Handler's own Date is kept
+	res = roundTrip(t, func(w *response.Writer, req *request.Request) {
+		w.Header().Set("Date", "Mon, 01 Jan 2024 00:00:00 GMT")
+		w.Header().Set("Content-Length", "0")
+		w.WriteHeader(response.StatusOk)
+	})
+	assert.Equal(t, "Mon, 01 Jan 2024 00:00:00 GMT", res.Headers.Get("Date"))
+}
@@ -0,0 +1,212 @@
+package sse
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Supasiti/prac-go-http-protocol/internal/request"
+	"github.com/Supasiti/prac-go-http-protocol/internal/response"
+)
+
+const (
+	ContentType       = "text/event-stream"
+	HeaderLastEventID = "Last-Event-ID"
+
+	DefaultHeartbeat = 15 * time.Second
+)
+
+var ErrClosed = errors.New("event stream closed")
+
+// ErrHeadRequest is returned by NewStream for a HEAD request, which gets the headers of a
+// stream but never its events
+var ErrHeadRequest = errors.New("event stream requested with HEAD")
+
+type Event struct {
+	ID    string
+	Event string
+	Data  string
+	Retry time.Duration
+}
+
+// Stream writes server-sent events over a chunked response. It is safe to send from
+// multiple goroutines.
+type Stream struct {
+	w           *response.Writer
+	lastEventID string
+
+	mu        sync.Mutex
+	done      chan struct{}
+	closeOnce sync.Once
+	err       error
+}
+
+// NewStream writes the headers of an event stream response and flushes them, so the
+// client sees the stream open straight away. For a HEAD request the response ends there,
+// with ErrHeadRequest.
+func NewStream(w *response.Writer, req *request.Request) (*Stream, error) {
+	h := w.Header()
+	h.Remove("Content-Length")
+	h.Set("Content-Type", ContentType)
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Transfer-Encoding", "chunked")
+
+	if err := w.WriteHeader(response.StatusOk); err != nil {
+		return nil, err
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	if req.RequestLine.Method == "HEAD" {
+		return nil, ErrHeadRequest
+	}
+
+	return &Stream{
+		w:           w,
+		lastEventID: req.Headers.Get(HeaderLastEventID),
+		done:        make(chan struct{}),
+	}, nil
+}
+
+// LastEventID is the id of the last event the client saw before reconnecting, if any
+func (s *Stream) LastEventID() string {
+	return s.lastEventID
+}
+
+// Done is closed once the stream is closed or the client has gone away
+func (s *Stream) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns the write error that ended the stream, if any
+func (s *Stream) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+func (s *Stream) Send(e Event) error {
+	msg, err := formatEvent(e)
+	if err != nil {
+		return err
+	}
+	return s.write(msg)
+}
+
+// Comment sends a comment line, which clients ignore. It keeps idle connections open
+// and surfaces dead ones.
+func (s *Stream) Comment(text string) error {
+	if strings.ContainsAny(text, "\r\n") {
+		return fmt.Errorf("comment contains a line break")
+	}
+	return s.write([]byte(": " + text + "\n\n"))
+}
+
+// Run sends events as they arrive, and a heartbeat comment whenever the stream has been
+// idle for the given interval. It returns nil when events is closed, or the write error
+// when the client disconnects.
+func (s *Stream) Run(events <-chan Event, heartbeat time.Duration) error {
+	if heartbeat <= 0 {
+		heartbeat = DefaultHeartbeat
+	}
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if err := s.Send(e); err != nil {
+				return err
+			}
+			ticker.Reset(heartbeat)
+		case <-ticker.C:
+			if err := s.Comment("heartbeat"); err != nil {
+				return err
+			}
+		case <-s.done:
+			return s.Err()
+		}
+	}
+}
+
+// Close ends the response with the last chunk
+func (s *Stream) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	select {
+	case <-s.done:
+		return s.err
+	default:
+	}
+	s.stop(nil)
+	return s.w.Close()
+}
+
+func (s *Stream) write(msg []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	select {
+	case <-s.done:
+		if s.err != nil {
+			return s.err
+		}
+		return ErrClosed
+	default:
+	}
+
+	if _, err := s.w.WriteChunkBody(msg); err != nil {
+		s.stop(err)
+		return err
+	}
+	if err := s.w.Flush(); err != nil {
+		s.stop(err)
+		return err
+	}
+	return nil
+}
+
+// stop must be called with mu held
+func (s *Stream) stop(err error) {
+	s.closeOnce.Do(func() {
+		s.err = err
+		close(s.done)
+	})
+}
+
+func formatEvent(e Event) ([]byte, error) {
+	if strings.ContainsAny(e.Event, "\r\n") {
+		return nil, fmt.Errorf("event name contains a line break")
+	}
+	if strings.ContainsAny(e.ID, "\r\n\x00") {
+		return nil, fmt.Errorf("event id contains a line break or NULL")
+	}
+
+	var b strings.Builder
+	if e.ID != "" {
+		b.WriteString("id: " + e.ID + "\n")
+	}
+	if e.Event != "" {
+		b.WriteString("event: " + e.Event + "\n")
+	}
+	if e.Retry > 0 {
+		b.WriteString("retry: " + strconv.FormatInt(e.Retry.Milliseconds(), 10) + "\n")
+	}
+
+	// every line of the payload needs its own data field
+	data := strings.ReplaceAll(e.Data, "\r\n", "\n")
+	data = strings.ReplaceAll(data, "\r", "\n")
+	for _, line := range strings.Split(data, "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+
+	return []byte(b.String()), nil
+}
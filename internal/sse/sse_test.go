@@ -0,0 +1,117 @@
+package sse
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Supasiti/prac-go-http-protocol/internal/headers"
+	"github.com/Supasiti/prac-go-http-protocol/internal/request"
+	"github.com/Supasiti/prac-go-http-protocol/internal/response"
+)
+
+func newRequest(lastEventID string) *request.Request {
+	h := headers.NewHeaders()
+	if lastEventID != "" {
+		h.Set(HeaderLastEventID, lastEventID)
+	}
+	return &request.Request{
+		RequestLine: &request.RequestLine{Method: "GET", RequestTarget: "/events", HttpVersion: "1.1"},
+		Headers:     h,
+	}
+}
+
+func TestStream(t *testing.T) {
+	// Test: Headers are flushed when the stream opens
+	buf := &bytes.Buffer{}
+	s, err := NewStream(response.NewWriter(buf), newRequest("41"))
+	require.NoError(t, err)
+	assert.Equal(t, "41", s.LastEventID())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Type: text/event-stream\r\n"+
+		"Cache-Control: no-cache\r\n"+
+		"Transfer-Encoding: chunked\r\n"+
+		"\r\n", buf.String())
+
+	// Test: Event fields with multi-line data
+	buf.Reset()
+	require.NoError(t, s.Send(Event{ID: "42", Event: "tick", Data: "line 1\r\nline 2", Retry: 3 * time.Second}))
+	msg := "id: 42\nevent: tick\nretry: 3000\ndata: line 1\ndata: line 2\n\n"
+	assert.Equal(t, fmt.Sprintf("%X\r\n%s\r\n", len(msg), msg), buf.String())
+
+	// Test: Comment
+	buf.Reset()
+	require.NoError(t, s.Comment("ping"))
+	assert.Equal(t, "8\r\n: ping\n\n\r\n", buf.String())
+
+	// Test: Line breaks in single line fields are rejected
+	require.Error(t, s.Send(Event{Event: "bad\nname"}))
+	require.Error(t, s.Send(Event{ID: "1\n2"}))
+
+	// Test: Close ends the chunked body
+	buf.Reset()
+	require.NoError(t, s.Close())
+	assert.Equal(t, "0\r\n\r\n", buf.String())
+	require.ErrorIs(t, s.Send(Event{Data: "late"}), ErrClosed)
+
+	// Test: HEAD gets the headers and no stream
+	buf.Reset()
+	req := newRequest("")
+	req.RequestLine.Method = "HEAD"
+	w := response.NewWriter(buf)
+	w.SetRequestMethod("HEAD")
+	s, err = NewStream(w, req)
+	require.ErrorIs(t, err, ErrHeadRequest)
+	assert.Nil(t, s)
+	require.NoError(t, w.Close())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Type: text/event-stream\r\n"+
+		"Cache-Control: no-cache\r\n"+
+		"Transfer-Encoding: chunked\r\n"+
+		"\r\n", buf.String())
+}
+
+func TestStreamRun(t *testing.T) {
+	// Test: Events until the channel closes
+	buf := &bytes.Buffer{}
+	s, err := NewStream(response.NewWriter(buf), newRequest(""))
+	require.NoError(t, err)
+	events := make(chan Event, 2)
+	events <- Event{Data: "one"}
+	events <- Event{Data: "two"}
+	close(events)
+	require.NoError(t, s.Run(events, time.Hour))
+	assert.Contains(t, buf.String(), "data: one\n\n")
+	assert.Contains(t, buf.String(), "data: two\n\n")
+
+	// Test: Heartbeat reveals a disconnected client
+	conn := &brokenConn{}
+	s, err = NewStream(response.NewWriter(conn), newRequest(""))
+	require.NoError(t, err)
+	conn.broken = true
+	err = s.Run(make(chan Event), 10*time.Millisecond)
+	require.ErrorIs(t, err, errBroken)
+	select {
+	case <-s.Done():
+	default:
+		t.Fatal("stream should be done")
+	}
+}
+
+var errBroken = errors.New("broken pipe")
+
+type brokenConn struct {
+	broken bool
+}
+
+func (c *brokenConn) Write(p []byte) (int, error) {
+	if c.broken {
+		return 0, errBroken
+	}
+	return len(p), nil
+}
@@ -0,0 +1,413 @@
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"unicode/utf8"
+)
+
+type Opcode byte
+
+const (
+	OpContinuation Opcode = 0x0
+	OpText         Opcode = 0x1
+	OpBinary       Opcode = 0x2
+	OpClose        Opcode = 0x8
+	OpPing         Opcode = 0x9
+	OpPong         Opcode = 0xA
+)
+
+// Close codes (RFC 6455 7.4.1)
+const (
+	CloseNormal          = 1000
+	CloseGoingAway       = 1001
+	CloseProtocolError   = 1002
+	CloseUnsupportedData = 1003
+	CloseNoStatus        = 1005
+	CloseAbnormal        = 1006
+	CloseInvalidPayload  = 1007
+	ClosePolicyViolation = 1008
+	CloseMessageTooBig   = 1009
+	CloseMandatoryExt    = 1010
+	CloseInternalError   = 1011
+)
+
+const DefaultMaxMessageSize = 1 << 20
+
+const maxControlPayload = 125
+
+var (
+	ErrClosed          = errors.New("websocket connection closed")
+	ErrMessageTooLarge = errors.New("websocket message too large")
+)
+
+// CloseError is returned by ReadMessage once the peer has sent a close frame
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("websocket closed: %d %s", e.Code, e.Reason)
+}
+
+type frame struct {
+	fin     bool
+	opcode  Opcode
+	payload []byte
+}
+
+// Conn reads and writes WebSocket messages over an established connection. Reads must
+// happen from a single goroutine; writes may come from several.
+type Conn struct {
+	r        *bufio.Reader
+	w        io.Writer
+	isServer bool
+	netConn  net.Conn
+
+	MaxMessageSize int64
+
+	writeMu   sync.Mutex
+	closeSent bool
+	closed    bool
+}
+
+// NewConn wraps a connection after the opening handshake. Servers expect masked frames from
+// the client and send unmasked ones; clients do the opposite.
+func NewConn(rw io.ReadWriter, isServer bool) *Conn {
+	return &Conn{
+		r:              bufio.NewReader(rw),
+		w:              rw,
+		isServer:       isServer,
+		MaxMessageSize: DefaultMaxMessageSize,
+	}
+}
+
+// NetConn returns the connection taken over by Upgrade, or nil for a Conn made with NewConn
+func (c *Conn) NetConn() net.Conn {
+	return c.netConn
+}
+
+// ReadMessage returns the next text or binary message, joining fragments. Pings are
+// answered and pongs dropped along the way. When the peer closes, the close frame is echoed
+// and a *CloseError is returned.
+func (c *Conn) ReadMessage() (Opcode, []byte, error) {
+	if c.closed {
+		return 0, nil, ErrClosed
+	}
+
+	var (
+		msgType Opcode
+		msg     []byte
+	)
+	for {
+		f, err := c.readFrame()
+		if err != nil {
+			return 0, nil, c.fail(err)
+		}
+
+		switch f.opcode {
+		case OpPing:
+			if err := c.writeFrame(OpPong, true, f.payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case OpPong:
+			continue
+		case OpClose:
+			return 0, nil, c.handleClose(f.payload)
+		case OpText, OpBinary:
+			if msgType != 0 {
+				return 0, nil, c.fail(protocolError("new message before the previous one finished"))
+			}
+			msgType = f.opcode
+		case OpContinuation:
+			if msgType == 0 {
+				return 0, nil, c.fail(protocolError("continuation frame without a message"))
+			}
+		default:
+			return 0, nil, c.fail(protocolError(fmt.Sprintf("unknown opcode %d", f.opcode)))
+		}
+
+		if int64(len(msg)+len(f.payload)) > c.MaxMessageSize {
+			return 0, nil, c.fail(ErrMessageTooLarge)
+		}
+		msg = append(msg, f.payload...)
+
+		if f.fin {
+			if msgType == OpText && !utf8.Valid(msg) {
+				return 0, nil, c.fail(&CloseError{Code: CloseInvalidPayload, Reason: "invalid utf-8"})
+			}
+			return msgType, msg, nil
+		}
+	}
+}
+
+// WriteMessage sends data as a single frame
+func (c *Conn) WriteMessage(op Opcode, data []byte) error {
+	if op != OpText && op != OpBinary {
+		return fmt.Errorf("not a data opcode: %d", op)
+	}
+	return c.writeFrame(op, true, data)
+}
+
+// NextWriter returns a writer that sends every Write as a fragment of one message, and
+// the final fragment on Close
+func (c *Conn) NextWriter(op Opcode) (io.WriteCloser, error) {
+	if op != OpText && op != OpBinary {
+		return nil, fmt.Errorf("not a data opcode: %d", op)
+	}
+	return &messageWriter{c: c, op: op}, nil
+}
+
+func (c *Conn) Ping(data []byte) error {
+	if len(data) > maxControlPayload {
+		return fmt.Errorf("ping payload longer than %d bytes", maxControlPayload)
+	}
+	return c.writeFrame(OpPing, true, data)
+}
+
+// Close starts the closing handshake. The caller keeps reading until ReadMessage returns
+// the peer's *CloseError, then closes the underlying connection.
+func (c *Conn) Close(code int, reason string) error {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	payload = append(payload, reason...)
+	if len(payload) > maxControlPayload {
+		return fmt.Errorf("close reason longer than %d bytes", maxControlPayload-2)
+	}
+	return c.writeFrame(OpClose, true, payload)
+}
+
+func (c *Conn) handleClose(payload []byte) error {
+	closeErr := &CloseError{Code: CloseNoStatus}
+	switch {
+	case len(payload) == 1:
+		return c.fail(protocolError("close payload of 1 byte"))
+	case len(payload) >= 2:
+		closeErr.Code = int(binary.BigEndian.Uint16(payload))
+		closeErr.Reason = string(payload[2:])
+		if !validCloseCode(closeErr.Code) {
+			return c.fail(protocolError(fmt.Sprintf("invalid close code %d", closeErr.Code)))
+		}
+		if !utf8.ValidString(closeErr.Reason) {
+			return c.fail(&CloseError{Code: CloseInvalidPayload, Reason: "invalid utf-8"})
+		}
+	}
+
+	// echo the close frame to finish the handshake
+	echo := payload
+	if len(payload) >= 2 {
+		echo = payload[:2]
+	}
+	c.writeFrame(OpClose, true, echo)
+	c.closed = true
+	return closeErr
+}
+
+// fail closes the connection with a status matching err, and returns err
+func (c *Conn) fail(err error) error {
+	var closeErr *CloseError
+	switch {
+	case errors.As(err, &closeErr):
+		c.Close(closeErr.Code, closeErr.Reason)
+	case errors.Is(err, ErrMessageTooLarge):
+		c.Close(CloseMessageTooBig, "")
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		err = &CloseError{Code: CloseAbnormal, Reason: err.Error()}
+	}
+	c.closed = true
+	return err
+}
+
+func (c *Conn) readFrame() (*frame, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.r, head[:]); err != nil {
+		return nil, err
+	}
+
+	f := &frame{
+		fin:    head[0]&0x80 != 0,
+		opcode: Opcode(head[0] & 0x0F),
+	}
+	if head[0]&0x70 != 0 {
+		return nil, protocolError("reserved bits set without an extension")
+	}
+
+	masked := head[1]&0x80 != 0
+	if masked != c.isServer {
+		return nil, protocolError("wrong masking for this side of the connection")
+	}
+
+	length := int64(head[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return nil, err
+		}
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return nil, err
+		}
+		n := binary.BigEndian.Uint64(ext[:])
+		if n > 1<<63-1 {
+			return nil, protocolError("payload length with the high bit set")
+		}
+		length = int64(n)
+	}
+
+	if f.opcode >= OpClose {
+		if !f.fin {
+			return nil, protocolError("fragmented control frame")
+		}
+		if length > maxControlPayload {
+			return nil, protocolError("control frame payload too long")
+		}
+	}
+	if length > c.MaxMessageSize {
+		return nil, ErrMessageTooLarge
+	}
+
+	var key [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.r, key[:]); err != nil {
+			return nil, err
+		}
+	}
+
+	f.payload = make([]byte, length)
+	if _, err := io.ReadFull(c.r, f.payload); err != nil {
+		return nil, err
+	}
+	if masked {
+		maskBytes(key, f.payload)
+	}
+	return f, nil
+}
+
+func (c *Conn) writeFrame(op Opcode, fin bool, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.closeSent {
+		return ErrClosed
+	}
+	if op == OpClose {
+		c.closeSent = true
+	}
+
+	buf := make([]byte, 0, 14+len(payload))
+	b0 := byte(op)
+	if fin {
+		b0 |= 0x80
+	}
+	buf = append(buf, b0)
+
+	var maskBit byte
+	if !c.isServer {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n <= 125:
+		buf = append(buf, maskBit|byte(n))
+	case n <= 0xFFFF:
+		buf = append(buf, maskBit|126)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(n))
+	default:
+		buf = append(buf, maskBit|127)
+		buf = binary.BigEndian.AppendUint64(buf, uint64(n))
+	}
+
+	if c.isServer {
+		buf = append(buf, payload...)
+	} else {
+		var key [4]byte
+		if _, err := rand.Read(key[:]); err != nil {
+			return err
+		}
+		buf = append(buf, key[:]...)
+		start := len(buf)
+		buf = append(buf, payload...)
+		maskBytes(key, buf[start:])
+	}
+
+	if _, err := c.w.Write(buf); err != nil {
+		return err
+	}
+	if f, ok := c.w.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+type messageWriter struct {
+	c       *Conn
+	op      Opcode
+	started bool
+	closed  bool
+}
+
+func (m *messageWriter) Write(p []byte) (int, error) {
+	if m.closed {
+		return 0, ErrClosed
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	op := OpContinuation
+	if !m.started {
+		op = m.op
+		m.started = true
+	}
+	if err := m.c.writeFrame(op, false, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (m *messageWriter) Close() error {
+	if m.closed {
+		return nil
+	}
+	m.closed = true
+
+	op := OpContinuation
+	if !m.started {
+		op = m.op
+	}
+	return m.c.writeFrame(op, true, nil)
+}
+
+func maskBytes(key [4]byte, p []byte) {
+	for i := range p {
+		p[i] ^= key[i%4]
+	}
+}
+
+func protocolError(reason string) error {
+	return &CloseError{Code: CloseProtocolError, Reason: reason}
+}
+
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 3000 && code <= 4999:
+		return true
+	case code == CloseNoStatus, code == CloseAbnormal, code == 1015:
+		// reserved for reporting, never sent on the wire
+		return false
+	case code >= 1000 && code <= 1014:
+		return code != 1004
+	default:
+		return false
+	}
+}
@@ -0,0 +1,118 @@
+package websocket
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Supasiti/prac-go-http-protocol/internal/request"
+	"github.com/Supasiti/prac-go-http-protocol/internal/response"
+)
+
+// acceptGUID is appended to the client key to prove the server speaks WebSocket
+// (RFC 6455 1.3)
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const version = "13"
+
+var ErrBadHandshake = errors.New("bad websocket handshake")
+
+// CheckRequest validates an opening handshake from a client (RFC 6455 4.2.1)
+func CheckRequest(req *request.Request) error {
+	if req.RequestLine.Method != "GET" {
+		return fmt.Errorf("%w: method must be GET, got %s", ErrBadHandshake, req.RequestLine.Method)
+	}
+	if !hasToken(req.Headers.Get("Upgrade"), "websocket") {
+		return fmt.Errorf("%w: missing Upgrade: websocket", ErrBadHandshake)
+	}
+	if !hasToken(req.Headers.Get("Connection"), "upgrade") {
+		return fmt.Errorf("%w: missing Connection: Upgrade", ErrBadHandshake)
+	}
+	if req.Headers.Get("Sec-WebSocket-Version") != version {
+		return fmt.Errorf("%w: unsupported version %q", ErrBadHandshake, req.Headers.Get("Sec-WebSocket-Version"))
+	}
+
+	key := req.Headers.Get("Sec-WebSocket-Key")
+	decoded, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(decoded) != 16 {
+		return fmt.Errorf("%w: invalid Sec-WebSocket-Key", ErrBadHandshake)
+	}
+	return nil
+}
+
+// AcceptKey computes Sec-WebSocket-Accept for a Sec-WebSocket-Key
+func AcceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// Handshake validates the upgrade request and answers it with 101 Switching Protocols. An
+// invalid request is answered with 400, or 426 when only the version is wrong, and the
+// error is returned. After a successful handshake the connection speaks WebSocket frames.
+func Handshake(w *response.Writer, req *request.Request) error {
+	if err := CheckRequest(req); err != nil {
+		status := response.StatusBadRequest
+		if req.Headers.Get("Sec-WebSocket-Version") != version {
+			status = response.StatusUpgradeRequired
+			w.Header().Set("Sec-WebSocket-Version", version)
+		}
+
+		msg := []byte(err.Error())
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(msg)))
+		if werr := w.WriteHeader(status); werr != nil {
+			return werr
+		}
+		w.WriteBody(msg)
+		return err
+	}
+
+	h := w.Header()
+	h.Remove("Content-Length")
+	h.Remove("Content-Type")
+	h.Set("Upgrade", "websocket")
+	h.Set("Connection", "Upgrade")
+	h.Set("Sec-WebSocket-Accept", AcceptKey(req.Headers.Get("Sec-WebSocket-Key")))
+
+	if err := w.WriteHeader(response.StatusSwitchingProtocols); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// Upgrade performs the handshake and takes over the connection from the server. The caller
+// owns the returned Conn and closes its NetConn when done.
+func Upgrade(w *response.Writer, req *request.Request) (*Conn, error) {
+	if err := Handshake(w, req); err != nil {
+		return nil, err
+	}
+	netConn, buffered, err := w.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	// frames the client sent right after the handshake may already sit in the parser's buffer
+	var r io.Reader = netConn
+	if len(buffered) > 0 {
+		r = io.MultiReader(bytes.NewReader(buffered), netConn)
+	}
+	c := NewConn(struct {
+		io.Reader
+		io.Writer
+	}{r, netConn}, true)
+	c.netConn = netConn
+	return c, nil
+}
+
+func hasToken(value, token string) bool {
+	for _, t := range strings.Split(value, ",") {
+		if strings.EqualFold(strings.TrimSpace(t), token) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,232 @@
+package websocket
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Supasiti/prac-go-http-protocol/internal/headers"
+	"github.com/Supasiti/prac-go-http-protocol/internal/request"
+	"github.com/Supasiti/prac-go-http-protocol/internal/response"
+)
+
+func newUpgradeRequest() *request.Request {
+	h := headers.NewHeaders()
+	h.Set("Host", "localhost:42069")
+	h.Set("Upgrade", "websocket")
+	h.Set("Connection", "keep-alive, Upgrade")
+	h.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	h.Set("Sec-WebSocket-Version", "13")
+	return &request.Request{
+		RequestLine: &request.RequestLine{Method: "GET", RequestTarget: "/ws", HttpVersion: "1.1"},
+		Headers:     h,
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	// Test: Accept key from RFC 6455 1.3
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", AcceptKey("dGhlIHNhbXBsZSBub25jZQ=="))
+
+	// Test: Valid upgrade
+	buf := &bytes.Buffer{}
+	w := response.NewWriter(buf)
+	require.NoError(t, Handshake(w, newUpgradeRequest()))
+	assert.Equal(t, "HTTP/1.1 101 Switching Protocols\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Sec-Websocket-Accept: s3pPLMBiTxaQ9kYGzzhZRbK+xOo=\r\n"+
+		"\r\n", buf.String())
+
+	// Test: Missing upgrade header
+	req := newUpgradeRequest()
+	req.Headers.Remove("Upgrade")
+	require.ErrorIs(t, CheckRequest(req), ErrBadHandshake)
+	buf = &bytes.Buffer{}
+	w = response.NewWriter(buf)
+	require.Error(t, Handshake(w, req))
+	require.NoError(t, w.Close())
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 400 Bad Request\r\n"))
+
+	// Test: Wrong version asks for 13
+	req = newUpgradeRequest()
+	req.Headers.Set("Sec-WebSocket-Version", "8")
+	buf = &bytes.Buffer{}
+	w = response.NewWriter(buf)
+	require.Error(t, Handshake(w, req))
+	require.NoError(t, w.Close())
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 426 Upgrade Required\r\n"))
+	assert.Contains(t, buf.String(), "Sec-Websocket-Version: 13\r\n")
+
+	// Test: Invalid key
+	req = newUpgradeRequest()
+	req.Headers.Set("Sec-WebSocket-Key", "short")
+	require.ErrorIs(t, CheckRequest(req), ErrBadHandshake)
+
+	// Test: Must be GET
+	req = newUpgradeRequest()
+	req.RequestLine.Method = "POST"
+	require.ErrorIs(t, CheckRequest(req), ErrBadHandshake)
+}
+
+// tcpPair connects two sockets over loopback. Unlike net.Pipe, writes are buffered by the
+// kernel, so a peer echoing a frame does not block until the other side reads it.
+func tcpPair(t *testing.T) (net.Conn, net.Conn) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	accepted := make(chan net.Conn)
+	go func() {
+		conn, _ := l.Accept()
+		accepted <- conn
+	}()
+	b, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	a := <-accepted
+	require.NotNil(t, a)
+
+	t.Cleanup(func() {
+		a.Close()
+		b.Close()
+	})
+	return a, b
+}
+
+func newPair(t *testing.T) (*Conn, *Conn) {
+	a, b := tcpPair(t)
+	return NewConn(a, true), NewConn(b, false)
+}
+
+func TestConn(t *testing.T) {
+	// Test: Messages both ways, small and large
+	server, client := newPair(t)
+
+	large := bytes.Repeat([]byte("x"), 70000)
+	go func() {
+		client.WriteMessage(OpText, []byte("hello"))
+		client.WriteMessage(OpBinary, large)
+	}()
+	op, msg, err := server.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, OpText, op)
+	assert.Equal(t, "hello", string(msg))
+	op, msg, err = server.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, OpBinary, op)
+	assert.Equal(t, large, msg)
+
+	go server.WriteMessage(OpText, []byte("from server"))
+	op, msg, err = client.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, OpText, op)
+	assert.Equal(t, "from server", string(msg))
+
+	// Test: Fragmented message with a ping in between
+	go func() {
+		mw, _ := client.NextWriter(OpText)
+		mw.Write([]byte("frag"))
+		client.Ping([]byte("are you there"))
+		mw.Write([]byte("mented"))
+		mw.Close()
+	}()
+	pong := make(chan error)
+	go func() {
+		// the pong is dropped by the client while it waits for the next message
+		_, _, err := client.ReadMessage()
+		pong <- err
+	}()
+	op, msg, err = server.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, OpText, op)
+	assert.Equal(t, "fragmented", string(msg))
+
+	// Test: Close handshake
+	go server.Close(CloseNormal, "bye")
+	err = <-pong
+	var closeErr *CloseError
+	require.ErrorAs(t, err, &closeErr)
+	assert.Equal(t, CloseNormal, closeErr.Code)
+	assert.Equal(t, "bye", closeErr.Reason)
+	_, _, err = server.ReadMessage()
+	require.ErrorAs(t, err, &closeErr)
+	assert.Equal(t, CloseNormal, closeErr.Code)
+}
+
+func TestConnLimits(t *testing.T) {
+	// Test: Message over the size limit closes with 1009
+	server, client := newPair(t)
+	server.MaxMessageSize = 10
+
+	go client.WriteMessage(OpBinary, bytes.Repeat([]byte("x"), 11))
+	closed := make(chan error)
+	go func() {
+		_, _, err := client.ReadMessage()
+		closed <- err
+	}()
+	_, _, err := server.ReadMessage()
+	require.ErrorIs(t, err, ErrMessageTooLarge)
+	var closeErr *CloseError
+	require.ErrorAs(t, <-closed, &closeErr)
+	assert.Equal(t, CloseMessageTooBig, closeErr.Code)
+
+	// Test: Unmasked frame from a client is a protocol error
+	a, b := tcpPair(t)
+	server = NewConn(a, true)
+	go func() {
+		b.Write([]byte{0x81, 0x02, 'h', 'i'})
+		b.Read(make([]byte, 64))
+	}()
+	_, _, err = server.ReadMessage()
+	require.ErrorAs(t, err, &closeErr)
+	assert.Equal(t, CloseProtocolError, closeErr.Code)
+
+	// Test: Invalid utf-8 in a text message
+	server, client = newPair(t)
+	go func() {
+		client.WriteMessage(OpText, []byte{0xff, 0xfe})
+		client.ReadMessage()
+	}()
+	_, _, err = server.ReadMessage()
+	require.ErrorAs(t, err, &closeErr)
+	assert.Equal(t, CloseInvalidPayload, closeErr.Code)
+}
+
+func TestUpgrade(t *testing.T) {
+	// Test: Frames sent with the handshake are read before the connection
+	a, b := tcpPair(t)
+	client := NewConn(b, false)
+	early := &bytes.Buffer{}
+	require.NoError(t, NewConn(early, false).WriteMessage(OpText, []byte("early")))
+
+	w := response.NewWriter(a)
+	w.SetHijacker(func() (net.Conn, []byte, error) {
+		return a, early.Bytes(), nil
+	})
+	server, err := Upgrade(w, newUpgradeRequest())
+	require.NoError(t, err)
+	assert.True(t, w.Hijacked())
+	assert.Equal(t, a, server.NetConn())
+
+	go client.WriteMessage(OpText, []byte("late"))
+	_, msg, err := server.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, "early", string(msg))
+	_, msg, err = server.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, "late", string(msg))
+
+	// Test: Handshake failure leaves the connection with the server
+	req := newUpgradeRequest()
+	req.Headers.Remove("Upgrade")
+	w = response.NewWriter(&bytes.Buffer{})
+	w.SetHijacker(func() (net.Conn, []byte, error) {
+		return a, nil, nil
+	})
+	_, err = Upgrade(w, req)
+	require.ErrorIs(t, err, ErrBadHandshake)
+	assert.False(t, w.Hijacked())
+}